@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const common_log_time_format = "02/Jan/2006:15:04:05 -0700"
+
+type accessLog struct {
+	logger *slog.Logger
+	common io.Writer
+	mu     sync.Mutex
+	sample float64
+	skip   map[string]struct{}
+}
+
+func newAccessLog(opt *options) *accessLog {
+	if opt.accesslog == nil && opt.commonlog == nil {
+		return nil
+	}
+	a := &accessLog{
+		logger: opt.accesslog,
+		common: opt.commonlog,
+		sample: 1,
+		skip:   make(map[string]struct{}, len(opt.accesslogskip)),
+	}
+	if opt.accesslogsample != nil {
+		a.sample = *opt.accesslogsample
+	}
+	for _, path := range opt.accesslogskip {
+		a.skip[path] = struct{}{}
+	}
+	return a
+}
+
+func (a *accessLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.skip[r.URL.Path]; ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.sample < 1 && rand.Float64() >= a.sample {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rw := newResponseWriter(w)
+		next.ServeHTTP(expose(rw), r)
+		latency := time.Since(start)
+
+		remote := clientIP(r)
+		if a.logger != nil {
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rw.Status()),
+				slog.Int64("bytes", rw.bytes),
+				slog.Duration("latency", latency),
+				slog.String("remote_ip", remote),
+			}
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			a.logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+		}
+		if a.common != nil {
+			a.writeCommon(r, rw, remote, start)
+		}
+	})
+}
+
+func (a *accessLog) writeCommon(r *http.Request, rw *responseWriter, remote string, start time.Time) {
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if rw.bytes > 0 {
+		size = fmt.Sprintf("%d", rw.bytes)
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s\n",
+		remote, user, start.Format(common_log_time_format),
+		r.Method, r.URL.RequestURI(), r.Proto, rw.Status(), size)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	io.WriteString(a.common, line)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// one structured record per request
+func WithAccessLog(logger *slog.Logger) Option {
+	return func(options *options) error {
+		if logger == nil {
+			return fmt.Errorf("undefined access logger")
+		}
+		options.accesslog = logger
+		return nil
+	}
+}
+
+// access log lines in Common Log Format for legacy tooling
+func WithCommonLog(w io.Writer) Option {
+	return func(options *options) error {
+		if w == nil {
+			return fmt.Errorf("undefined common log writer")
+		}
+		options.commonlog = w
+		return nil
+	}
+}
+
+// rate in (0, 1], fraction of requests written to the access log
+func WithAccessLogSampling(rate float64) Option {
+	return func(options *options) error {
+		if rate <= 0 || rate > 1 {
+			return fmt.Errorf("access log sampling rate must be in (0, 1]")
+		}
+		options.accesslogsample = &rate
+		return nil
+	}
+}
+
+// requests to these exact paths are not logged, e.g. "/healthz"
+func WithAccessLogSkipPaths(paths ...string) Option {
+	return func(options *options) error {
+		options.accesslogskip = append(options.accesslogskip, paths...)
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const default_api_key_header = "X-API-Key"
+
+type authGuard struct {
+	paths []string
+	check func(r *http.Request) bool
+	deny  func(w http.ResponseWriter)
+}
+
+// an empty list protects every path; "/admin" covers "/admin" and "/admin/..."
+func matchPath(paths []string, path string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if path == p {
+			return true
+		}
+		prefix := p
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func authMiddleware(guards []*authGuard, st *stats) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, g := range guards {
+				if matchPath(g.paths, r.URL.Path) && !g.check(r) {
+					st.authfailures.Add(1)
+					g.deny(w)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// compares in constant time regardless of the lengths
+func secureCompare(given, expected string) bool {
+	g := sha256.Sum256([]byte(given))
+	e := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(g[:], e[:]) == 1
+}
+
+// constant-time check for a single user, for use with WithBasicAuth
+func BasicAuthCredentials(user, pass string) func(user, pass string) bool {
+	return func(u, p string) bool {
+		// both are compared to avoid revealing which one is wrong
+		okuser := secureCompare(u, user)
+		okpass := secureCompare(p, pass)
+		return okuser && okpass
+	}
+}
+
+// requires HTTP basic auth on paths (all paths when none given)
+func WithBasicAuth(realm string, creds func(user, pass string) bool, paths ...string) Option {
+	return func(options *options) error {
+		if creds == nil {
+			return fmt.Errorf("undefined basic auth credentials")
+		}
+		challenge := fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm)
+		options.auth = append(options.auth, &authGuard{
+			paths: paths,
+			check: func(r *http.Request) bool {
+				user, pass, ok := r.BasicAuth()
+				return ok && creds(user, pass)
+			},
+			deny: func(w http.ResponseWriter) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+			},
+		})
+		return nil
+	}
+}
+
+// requires one of keys in header (X-API-Key when empty) on paths
+// (all paths when none given)
+func WithAPIKey(header string, keys []string, paths ...string) Option {
+	return func(options *options) error {
+		if len(keys) == 0 {
+			return fmt.Errorf("api key auth requires at least one key")
+		}
+		for _, k := range keys {
+			if k == "" {
+				return fmt.Errorf("empty api key")
+			}
+		}
+		if header == "" {
+			header = default_api_key_header
+		}
+		keys := append([]string(nil), keys...)
+		options.auth = append(options.auth, &authGuard{
+			paths: paths,
+			check: func(r *http.Request) bool {
+				given := r.Header.Get(header)
+				ok := false
+				for _, k := range keys {
+					if secureCompare(given, k) {
+						ok = true
+					}
+				}
+				return given != "" && ok
+			},
+			deny: func(w http.ResponseWriter) {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+			},
+		})
+		return nil
+	}
+}
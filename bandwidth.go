@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const bandwidth_chunk = 32 << 10
+
+// token bucket in bytes per second with a burst of one second; reservations
+// may overdraw it, the caller then waits until the debt is paid off
+type throttle struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newThrottle(rate int64) *throttle {
+	return &throttle{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (t *throttle) reserve(n int, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = min(t.rate, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	t.tokens -= float64(n)
+	if t.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
+
+type bandwidthLimit struct {
+	global  *throttle
+	perconn int64
+	chunk   int
+}
+
+type throttledListener struct {
+	net.Listener
+	limit *bandwidthLimit
+}
+
+func (l *throttledListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &throttledConn{Conn: c, limit: l.limit, done: make(chan struct{})}
+	if l.limit.perconn > 0 {
+		tc.conn = newThrottle(l.limit.perconn)
+	}
+	return tc, nil
+}
+
+type throttledConn struct {
+	net.Conn
+	limit *bandwidthLimit
+	conn  *throttle
+	done  chan struct{}
+	once  sync.Once
+}
+
+// waits for n bytes in both buckets, returns early when the connection is closed
+func (c *throttledConn) wait(n int) {
+	now := time.Now()
+	var d time.Duration
+	if c.limit.global != nil {
+		d = c.limit.global.reserve(n, now)
+	}
+	if c.conn != nil {
+		d = max(d, c.conn.reserve(n, now))
+	}
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-c.done:
+	}
+}
+
+func (c *throttledConn) Read(b []byte) (int, error) {
+	if len(b) > c.limit.chunk {
+		b = b[:c.limit.chunk]
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.wait(n)
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b[:min(len(b), c.limit.chunk)]
+		c.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (c *throttledConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// bytes per second read and written over all connections and over each one,
+// zero leaves that scope unlimited
+func WithBandwidthLimit(global, perConn int64) Option {
+	return func(options *options) error {
+		if global < 0 || perConn < 0 {
+			return fmt.Errorf("bandwidth limit cannot be less than zero")
+		}
+		if global == 0 && perConn == 0 {
+			return fmt.Errorf("bandwidth limit requires a global or per connection rate")
+		}
+		bl := &bandwidthLimit{perconn: perConn, chunk: bandwidth_chunk}
+		if global > 0 {
+			bl.global = newThrottle(global)
+			bl.chunk = int(min(int64(bl.chunk), global))
+		}
+		if perConn > 0 {
+			bl.chunk = int(min(int64(bl.chunk), perConn))
+		}
+		options.bandwidthlimit = bl
+		return nil
+	}
+}
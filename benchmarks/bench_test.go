@@ -0,0 +1,135 @@
+package benchmarks_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	server "github.com/quietpleasure/server-http"
+	"github.com/quietpleasure/server-http/servertest"
+)
+
+var payload = bytes.Repeat([]byte("lorem ipsum dolor sit amet "), 400)
+
+func handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(payload)
+	})
+}
+
+type config struct {
+	name string
+	opts func(b *testing.B) []server.Option
+}
+
+var configs = []config{
+	{"none", func(b *testing.B) []server.Option { return nil }},
+	{"defaults", func(b *testing.B) []server.Option {
+		return []server.Option{
+			server.WithRecovery(),
+			server.WithRequestID(),
+			server.WithAccessLog(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			server.WithMaxBodyBytes(1 << 20),
+		}
+	}},
+	{"compression", func(b *testing.B) []server.Option {
+		return []server.Option{server.WithCompression(5, 1024, nil)}
+	}},
+}
+
+func newRequest(url string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	// set explicitly, so the client does not decompress
+	req.Header.Set("Accept-Encoding", "gzip")
+	return req
+}
+
+// the handler chain without sockets
+func BenchmarkInMemory(b *testing.B) {
+	for _, c := range configs {
+		b.Run(c.name, func(b *testing.B) {
+			s, err := server.New(context.Background(), handler(), c.opts(b)...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
+
+// full requests over loopback with keep-alive
+func BenchmarkServer(b *testing.B) {
+	all := append(configs[:len(configs):len(configs)], config{"tls", func(b *testing.B) []server.Option {
+		cert, key := selfSigned(b)
+		return []server.Option{server.WithTLS(cert, key)}
+	}})
+	for _, c := range all {
+		b.Run(c.name, func(b *testing.B) {
+			ts := servertest.NewTestServer(b, handler(), c.opts(b)...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := ts.Client.Do(newRequest(ts.URL + "/"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+// writes a certificate and key for 127.0.0.1 and returns their paths
+func selfSigned(b *testing.B) (string, string) {
+	b.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	keyder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir := b.TempDir()
+	cert, keyfile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(keyfile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyder}), 0o600); err != nil {
+		b.Fatal(err)
+	}
+	return cert, keyfile
+}
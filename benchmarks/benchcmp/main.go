@@ -0,0 +1,99 @@
+// Command benchcmp compares two go test -bench outputs and prints the change
+// of every metric per benchmark, averaged over repeated (-count) runs.
+//
+//	benchcmp old.txt new.txt
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var units = []string{"ns/op", "B/op", "allocs/op"}
+
+// benchmark name -> unit -> values of the runs
+type results map[string]map[string][]float64
+
+func parse(path string) (results, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res := make(results)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := fields[0]
+		if res[name] == nil {
+			res[name] = make(map[string][]float64)
+		}
+		// name, iterations, then value/unit pairs
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			res[name][fields[i+1]] = append(res[name][fields[i+1]], v)
+		}
+	}
+	return res, sc.Err()
+}
+
+func mean(vs []float64) float64 {
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: benchcmp old.txt new.txt")
+		os.Exit(2)
+	}
+	before, err := parse(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	after, err := parse(os.Args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	names := make([]string, 0, len(after))
+	for name := range after {
+		if _, ok := before[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "benchmark\tunit\told\tnew\tdelta\t")
+	for _, name := range names {
+		for _, unit := range units {
+			old, cur := before[name][unit], after[name][unit]
+			if len(old) == 0 || len(cur) == 0 {
+				continue
+			}
+			o, n := mean(old), mean(cur)
+			delta := "~"
+			if o != 0 {
+				delta = fmt.Sprintf("%+.2f%%", (n-o)/o*100)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.0f\t%.0f\t%s\t\n", name, unit, o, n, delta)
+		}
+	}
+	tw.Flush()
+}
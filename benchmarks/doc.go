@@ -0,0 +1,9 @@
+// Package benchmarks measures the server across configurations, in memory
+// (the handler chain only) and over real sockets, with allocations reported.
+//
+//	go test ./benchmarks -run '^$' -bench . -count 10 > new.txt
+//	go run ./benchmarks/benchcmp old.txt new.txt
+//
+// benchcmp prints the change of ns/op, B/op and allocs/op per benchmark
+// between two runs, e.g. before and after a middleware change.
+package benchmarks
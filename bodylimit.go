@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func maxBodyBytes(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodies with a declared larger length are rejected with 413, others fail
+// reading past the limit with *http.MaxBytesError
+func WithMaxBodyBytes(limit int64) Option {
+	return func(options *options) error {
+		if limit <= 0 {
+			return fmt.Errorf("max body bytes must be greater than zero")
+		}
+		options.maxbodybytes = &limit
+		return nil
+	}
+}
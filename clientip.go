@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// the resolved client address, the immediate peer unless it is a trusted proxy
+func ClientIPFromContext(ctx context.Context) netip.Addr {
+	addr, _ := ctx.Value(clientIPKey{}).(netip.Addr)
+	return addr
+}
+
+// client address as a string for logs and keys, falls back to RemoteAddr
+func clientIP(r *http.Request) string {
+	if addr := ClientIPFromContext(r.Context()); addr.IsValid() {
+		return addr.String()
+	}
+	return remoteIP(r)
+}
+
+type trustedProxies []netip.Prefix
+
+func (t trustedProxies) trusted(addr netip.Addr) bool {
+	for _, p := range t {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// walks the forwarding chain from the nearest hop and returns the first
+// address not belonging to a trusted proxy
+func (t trustedProxies) resolve(r *http.Request, peer netip.Addr) netip.Addr {
+	if !t.trusted(peer) {
+		return peer
+	}
+	var hops []netip.Addr
+	if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		hops = forwardedFor(fwd)
+	} else if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops = xForwardedFor(xff)
+	} else if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		hops = []netip.Addr{ip.Unmap()}
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		client = hops[i]
+		if !t.trusted(client) {
+			break
+		}
+	}
+	return client
+}
+
+func xForwardedFor(values []string) []netip.Addr {
+	var hops []netip.Addr
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			addr, err := netip.ParseAddr(strings.TrimSpace(part))
+			if err != nil {
+				// an unparsable hop breaks the chain of trust
+				hops = hops[:0]
+				continue
+			}
+			hops = append(hops, addr.Unmap())
+		}
+	}
+	return hops
+}
+
+// for= parameters of RFC 7239 Forwarded headers
+func forwardedFor(values []string) []netip.Addr {
+	var hops []netip.Addr
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				addr, err := parseForwardedNode(value)
+				if err != nil {
+					hops = hops[:0]
+					continue
+				}
+				hops = append(hops, addr)
+			}
+		}
+	}
+	return hops
+}
+
+func parseForwardedNode(node string) (netip.Addr, error) {
+	node = strings.Trim(node, `"`)
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return netip.Addr{}, fmt.Errorf("invalid forwarded node %q", node)
+		}
+		node = node[1:end]
+	} else if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	addr, err := netip.ParseAddr(node)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+func (t trustedProxies) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddr(remoteIP(r))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := t.resolve(r, peer.Unmap())
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, client)))
+	})
+}
+
+// forwarding headers (Forwarded, X-Forwarded-For, X-Real-IP) are honored only
+// from these peers, see ClientIPFromContext
+func WithTrustedProxies(cidrs []netip.Prefix) Option {
+	return func(options *options) error {
+		for _, p := range cidrs {
+			if !p.IsValid() {
+				return fmt.Errorf("invalid trusted proxy prefix %q", p)
+			}
+		}
+		options.trustedproxies = append(options.trustedproxies, masked(cidrs)...)
+		return nil
+	}
+}
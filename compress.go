@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var default_compress_types = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+type compressor struct {
+	level   int
+	minsize int
+	types   []string
+	pool    sync.Pool
+}
+
+func newCompressor(level, minsize int, types []string) *compressor {
+	if len(types) == 0 {
+		types = default_compress_types
+	}
+	c := &compressor{level: level, minsize: minsize, types: types}
+	c.pool.New = func() any {
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}
+	return c
+}
+
+func (c *compressor) eligible(contenttype string) bool {
+	mediatype, _, err := mime.ParseMediaType(contenttype)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		if t == mediatype {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(mediatype, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+			if k, v, ok := strings.Cut(params, "="); ok && strings.TrimSpace(k) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				return err == nil && q > 0
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compressor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, c: c}
+		defer cw.close()
+		next.ServeHTTP(expose(cw), r)
+	})
+}
+
+// buffers up to minsize bytes before deciding whether to compress
+type compressWriter struct {
+	http.ResponseWriter
+	c       *compressor
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	if code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.c.minsize {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// large reports whether the body is known to reach minsize
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	compress := large &&
+		h.Get("Content-Encoding") == "" &&
+		cw.status != http.StatusNoContent &&
+		cw.status != http.StatusNotModified &&
+		cw.status != http.StatusPartialContent &&
+		cw.c.eligible(h.Get("Content-Type"))
+	if compress {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		cw.gz = cw.c.pool.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.gz != nil {
+		_, err = cw.gz.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// nothing written, leave the implicit response to net/http
+			return
+		}
+		cw.decide(false)
+	}
+	if cw.gz != nil {
+		cw.gz.Close()
+		cw.gz.Reset(nil)
+		cw.c.pool.Put(cw.gz)
+		cw.gz = nil
+	}
+}
+
+// a flush before minsize is reached means streaming, compress if eligible
+func (cw *compressWriter) Flush() {
+	cw.FlushError()
+}
+
+// used by http.ResponseController
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		if err := cw.decide(true); err != nil {
+			return err
+		}
+	}
+	if cw.gz != nil {
+		if err := cw.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// through Write, the body has to pass the gzip writer
+func (cw *compressWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(writerOnly{cw}, src)
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// gzip responses of the given content types (text/* style wildcards allowed,
+// common text types by default) once they reach minSize bytes; responses
+// with a Content-Encoding already set are left untouched
+func WithCompression(level int, minSize int, types []string) Option {
+	return func(options *options) error {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return fmt.Errorf("invalid compression level %d", level)
+		}
+		if minSize < 0 {
+			return fmt.Errorf("compression min size cannot be less than zero")
+		}
+		options.compression = newCompressor(level, minSize, types)
+		return nil
+	}
+}
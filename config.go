@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration read from text (environment, JSON, YAML) in
+// time.ParseDuration syntax, e.g. "15s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config is a plain representation of the options, zero values keep the defaults.
+type Config struct {
+	Host              string   `env:"HOST" json:"host" yaml:"host"`
+	Port              int      `env:"PORT" json:"port" yaml:"port"`
+	ReadTimeout       Duration `env:"READ_TIMEOUT" json:"read_timeout" yaml:"read_timeout"`
+	ReadHeaderTimeout Duration `env:"READ_HEADER_TIMEOUT" json:"read_header_timeout" yaml:"read_header_timeout"`
+	WriteTimeout      Duration `env:"WRITE_TIMEOUT" json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       Duration `env:"IDLE_TIMEOUT" json:"idle_timeout" yaml:"idle_timeout"`
+	HandlerTimeout    Duration `env:"HANDLER_TIMEOUT" json:"handler_timeout" yaml:"handler_timeout"`
+	MaxHeaderBytes    int      `env:"MAX_HEADER_BYTES" json:"max_header_bytes" yaml:"max_header_bytes"`
+	MaxBodyBytes      int64    `env:"MAX_BODY_BYTES" json:"max_body_bytes" yaml:"max_body_bytes"`
+	MaxConnections    int      `env:"MAX_CONNECTIONS" json:"max_connections" yaml:"max_connections"`
+	TLSCertFile       string   `env:"TLS_CERT_FILE" json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile        string   `env:"TLS_KEY_FILE" json:"tls_key_file" yaml:"tls_key_file"`
+	Region            string   `env:"REGION" json:"region" yaml:"region"`
+	Zone              string   `env:"ZONE" json:"zone" yaml:"zone"`
+	InstanceID        string   `env:"INSTANCE_ID" json:"instance_id" yaml:"instance_id"`
+}
+
+func (c Config) Options() []Option {
+	var opts []Option
+	if c.Host != "" {
+		opts = append(opts, WithHost(c.Host))
+	}
+	if c.Port != 0 {
+		opts = append(opts, WithPort(c.Port))
+	}
+	if c.ReadTimeout != 0 {
+		opts = append(opts, WithReadTimeout(time.Duration(c.ReadTimeout)))
+	}
+	if c.ReadHeaderTimeout != 0 {
+		opts = append(opts, WithReadHeaderTimeout(time.Duration(c.ReadHeaderTimeout)))
+	}
+	if c.WriteTimeout != 0 {
+		opts = append(opts, WithWriteTimeout(time.Duration(c.WriteTimeout)))
+	}
+	if c.IdleTimeout != 0 {
+		opts = append(opts, WithIdleTimeout(time.Duration(c.IdleTimeout)))
+	}
+	if c.HandlerTimeout != 0 {
+		opts = append(opts, WithHandlerTimeout(time.Duration(c.HandlerTimeout), ""))
+	}
+	if c.MaxHeaderBytes != 0 {
+		opts = append(opts, WithMaxHeaderBytes(c.MaxHeaderBytes))
+	}
+	if c.MaxBodyBytes != 0 {
+		opts = append(opts, WithMaxBodyBytes(c.MaxBodyBytes))
+	}
+	if c.MaxConnections != 0 {
+		opts = append(opts, WithMaxConnections(c.MaxConnections))
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		opts = append(opts, WithTLS(c.TLSCertFile, c.TLSKeyFile))
+	}
+	if c.Region != "" || c.Zone != "" || c.InstanceID != "" {
+		opts = append(opts, WithTopology(c.Region, c.Zone, c.InstanceID))
+	}
+	return opts
+}
+
+// opts are applied after the config, e.g. for middleware
+func NewFromConfig(ctx context.Context, handler http.Handler, cfg Config, opts ...Option) (*Server, error) {
+	return New(ctx, handler, append(cfg.Options(), opts...)...)
+}
+
+// reads Config fields from prefix + "_" + env tag, e.g. APP_PORT for prefix "APP";
+// unset variables keep the zero value
+func ConfigFromEnv(prefix string) (Config, error) {
+	var cfg Config
+	v := reflect.ValueOf(&cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if prefix != "" {
+			name = strings.TrimSuffix(prefix, "_") + "_" + name
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+func setField(f reflect.Value, value string) error {
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported config field type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	default_cors_methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	default_cors_headers = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type"}
+)
+
+type CORSConfig struct {
+	// "*" allows any origin
+	AllowedOrigins []string
+	// defaults to GET, HEAD, POST
+	AllowedMethods []string
+	// request headers allowed in preflight, "*" allows any
+	AllowedHeaders []string
+	// response headers readable by the client
+	ExposedHeaders []string
+	// requires listed origins, it cannot be combined with "*"
+	AllowCredentials bool
+	// how long a preflight may be cached, zero omits the header
+	MaxAge time.Duration
+}
+
+type cors struct {
+	cfg       CORSConfig
+	anyorigin bool
+	origins   map[string]struct{}
+	methods   string
+	headers   string
+	anyheader bool
+	exposed   string
+}
+
+func newCORS(cfg CORSConfig) *cors {
+	c := &cors{cfg: cfg, origins: make(map[string]struct{})}
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			c.anyorigin = true
+			continue
+		}
+		c.origins[strings.ToLower(o)] = struct{}{}
+	}
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = default_cors_methods
+	}
+	c.methods = strings.Join(methods, ", ")
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = default_cors_headers
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.anyheader = true
+		}
+	}
+	c.headers = strings.Join(headers, ", ")
+	c.exposed = strings.Join(cfg.ExposedHeaders, ", ")
+	return c
+}
+
+func (c *cors) allowed(origin string) bool {
+	if c.anyorigin {
+		return true
+	}
+	_, ok := c.origins[strings.ToLower(origin)]
+	return ok
+}
+
+func (c *cors) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if origin == "" || !c.allowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.anyorigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", c.methods)
+			if reqheaders := r.Header.Get("Access-Control-Request-Headers"); reqheaders != "" {
+				if c.anyheader {
+					h.Set("Access-Control-Allow-Headers", reqheaders)
+				} else {
+					h.Set("Access-Control-Allow-Headers", c.headers)
+				}
+			}
+			if c.cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if c.exposed != "" {
+			h.Set("Access-Control-Expose-Headers", c.exposed)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// answers preflight requests and adds CORS headers to responses for allowed origins
+func WithCORS(cfg CORSConfig) Option {
+	return func(options *options) error {
+		if len(cfg.AllowedOrigins) == 0 {
+			return fmt.Errorf("cors requires at least one allowed origin")
+		}
+		if cfg.MaxAge < 0 {
+			return fmt.Errorf("cors max age cannot be less than zero")
+		}
+		if cfg.AllowCredentials && slices.Contains(cfg.AllowedOrigins, "*") {
+			return fmt.Errorf("cors credentials cannot be allowed for any origin")
+		}
+		options.cors = newCORS(cfg)
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// tells an external load balancer about the drain; DrainStarted should return
+// once the balancer has stopped sending new traffic, the server keeps serving
+// until then
+type DrainCoordinator interface {
+	DrainStarted(ctx context.Context) error
+	DrainCompleted(ctx context.Context) error
+}
+
+// adapts plain functions, either may be nil
+type DrainFuncs struct {
+	Started   func(ctx context.Context) error
+	Completed func(ctx context.Context) error
+}
+
+func (f DrainFuncs) DrainStarted(ctx context.Context) error {
+	if f.Started == nil {
+		return nil
+	}
+	return f.Started(ctx)
+}
+
+func (f DrainFuncs) DrainCompleted(ctx context.Context) error {
+	if f.Completed == nil {
+		return nil
+	}
+	return f.Completed(ctx)
+}
+
+// calls a load balancer or discovery API, each non-empty URL gets a POST and
+// must answer 2xx; the started call should block until the target is removed
+type HTTPDrainCoordinator struct {
+	StartedURL   string
+	CompletedURL string
+	// http.DefaultClient when nil
+	Client *http.Client
+}
+
+func (c *HTTPDrainCoordinator) DrainStarted(ctx context.Context) error {
+	return c.post(ctx, c.StartedURL)
+}
+
+func (c *HTTPDrainCoordinator) DrainCompleted(ctx context.Context) error {
+	return c.post(ctx, c.CompletedURL)
+}
+
+func (c *HTTPDrainCoordinator) post(ctx context.Context, url string) error {
+	if url == "" {
+		return nil
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return nil
+}
+
+type drainCoordinator struct {
+	DrainCoordinator
+	timeout time.Duration
+}
+
+// DrainStarted runs before connections are drained and DrainCompleted after,
+// each waits at most timeout; a failure is logged and returned by the stop
+// but does not hold the shutdown back
+func WithDrainCoordinator(c DrainCoordinator, timeout time.Duration) Option {
+	return func(options *options) error {
+		if c == nil {
+			return fmt.Errorf("undefined drain coordinator")
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("drain coordinator timeout must be greater than zero")
+		}
+		options.draincoordinator = &drainCoordinator{DrainCoordinator: c, timeout: timeout}
+		return nil
+	}
+}
+
+func (s *Server) coordinateDrain(base context.Context, phase string) error {
+	dc := s.draincoordinator
+	if dc == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(base, dc.timeout)
+	defer cancel()
+	fn := dc.DrainStarted
+	if phase == "completed" {
+		fn = dc.DrainCompleted
+	}
+	if err := fn(ctx); err != nil {
+		s.logger.Error("drain coordinator", "phase", phase, "error", err)
+		return fmt.Errorf("drain coordinator, drain %s: %w", phase, err)
+	}
+	return nil
+}
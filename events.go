@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventServerStarted  EventType = "server.started"
+	EventServerDraining EventType = "server.draining"
+	EventServerStopped  EventType = "server.stopped"
+	// the WithMemoryPressure level changed, see Server.MemoryPressure
+	EventMemoryPressure   EventType = "server.memory_pressure"
+	EventRequestReceived  EventType = "request.received"
+	EventRequestCompleted EventType = "request.completed"
+)
+
+// request fields are empty for server events
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	Topology  Topology
+	RequestID string
+	Method    string
+	Path      string
+	ClientIP  string
+	// set on request.completed
+	Status   int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// Publish is called on the request path and must not block
+type EventBus interface {
+	Publish(Event)
+}
+
+type EventFunc func(Event)
+
+func (f EventFunc) Publish(e Event) {
+	f(e)
+}
+
+// ChanBus delivers events on a buffered channel, dropping them when it is full.
+type ChanBus struct {
+	c       chan Event
+	dropped atomic.Uint64
+}
+
+func NewChanBus(size int) *ChanBus {
+	return &ChanBus{c: make(chan Event, size)}
+}
+
+func (b *ChanBus) Publish(e Event) {
+	select {
+	case b.c <- e:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+func (b *ChanBus) Events() <-chan Event {
+	return b.c
+}
+
+func (b *ChanBus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+func eventsMiddleware(bus EventBus, topology *Topology) func(http.Handler) http.Handler {
+	var t Topology
+	if topology != nil {
+		t = *topology
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			e := Event{
+				Type:      EventRequestReceived,
+				Time:      start,
+				Topology:  t,
+				RequestID: RequestIDFromContext(r.Context()),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				ClientIP:  clientIP(r),
+			}
+			bus.Publish(e)
+			rw := newResponseWriter(w)
+			next.ServeHTTP(expose(rw), r)
+			e.Type = EventRequestCompleted
+			e.Time = time.Now()
+			e.Status = rw.Status()
+			e.Bytes = rw.bytes
+			e.Duration = e.Time.Sub(start)
+			bus.Publish(e)
+		})
+	}
+}
+
+func (s *Server) publish(t EventType) {
+	if s.events != nil {
+		s.events.Publish(Event{Type: t, Time: time.Now(), Topology: s.topology})
+	}
+}
+
+// publishes server lifecycle and per-request events to bus
+func WithEvents(bus EventBus) Option {
+	return func(options *options) error {
+		if bus == nil {
+			return fmt.Errorf("undefined event bus")
+		}
+		options.events = bus
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const min_fingerprint_salt_length = 16
+
+type clientFingerprintKey struct{}
+
+// empty unless WithClientFingerprint is set
+func ClientFingerprintFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(clientFingerprintKey{}).(string)
+	return id
+}
+
+// rate limit key for WithRateLimitKey, falls back to the client IP
+func ClientFingerprintKey(r *http.Request) string {
+	if id := ClientFingerprintFromContext(r.Context()); id != "" {
+		return id
+	}
+	return clientIP(r)
+}
+
+type clientFingerprint struct {
+	salt     []byte
+	rotation time.Duration
+}
+
+// keyed hash of the client IP, negotiated TLS parameters and a few stable
+// request headers; the key changes every rotation, so identifiers cannot be
+// linked across periods nor reversed without the salt
+func (f *clientFingerprint) compute(r *http.Request, now time.Time) string {
+	var period [8]byte
+	binary.BigEndian.PutUint64(period[:], uint64(now.UnixNano()/int64(f.rotation)))
+	key := hmac.New(sha256.New, f.salt)
+	key.Write(period[:])
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	for _, v := range []string{
+		clientIP(r),
+		r.Header.Get("User-Agent"),
+		r.Header.Get("Accept-Language"),
+		r.Header.Get("Accept-Encoding"),
+	} {
+		mac.Write([]byte(v))
+		mac.Write([]byte{0})
+	}
+	if r.TLS != nil {
+		for _, v := range []string{
+			strconv.Itoa(int(r.TLS.Version)),
+			strconv.Itoa(int(r.TLS.CipherSuite)),
+			r.TLS.NegotiatedProtocol,
+			r.TLS.ServerName,
+		} {
+			mac.Write([]byte(v))
+			mac.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (f *clientFingerprint) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := f.compute(r, time.Now())
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientFingerprintKey{}, id)))
+	})
+}
+
+// cookie-less client identifier for rate limiting and abuse detection, see
+// ClientFingerprintFromContext and ClientFingerprintKey; salt must be secret
+// and at least 16 bytes, identifiers change every rotation
+func WithClientFingerprint(salt []byte, rotation time.Duration) Option {
+	return func(options *options) error {
+		if len(salt) < min_fingerprint_salt_length {
+			return fmt.Errorf("client fingerprint salt must be at least %d bytes", min_fingerprint_salt_length)
+		}
+		if rotation <= 0 {
+			return fmt.Errorf("client fingerprint rotation must be greater than zero")
+		}
+		options.clientfingerprint = &clientFingerprint{salt: append([]byte(nil), salt...), rotation: rotation}
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+type gcTuning struct {
+	ballastmib int
+	gogc       int
+	memlimit   int64
+}
+
+// applied once at startup; ballast is kept alive with the server
+func (g *gcTuning) apply() []byte {
+	if g.gogc != 0 {
+		debug.SetGCPercent(g.gogc)
+	}
+	if g.memlimit > 0 {
+		debug.SetMemoryLimit(g.memlimit)
+	}
+	if g.ballastmib > 0 {
+		return make([]byte, g.ballastmib<<20)
+	}
+	return nil
+}
+
+// parses GOMEMLIMIT style sizes, e.g. "512MiB", "2GiB" or plain bytes
+func parseMemLimit(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		shift  uint
+	}{
+		{"TiB", 40}, {"GiB", 30}, {"MiB", 20}, {"KiB", 10}, {"B", 0},
+	}
+	num := strings.TrimSpace(s)
+	var shift uint
+	for _, u := range units {
+		if strings.HasSuffix(num, u.suffix) {
+			num = strings.TrimSuffix(num, u.suffix)
+			shift = u.shift
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 || n > (1<<63-1)>>shift {
+		return 0, fmt.Errorf("invalid memory limit %q", s)
+	}
+	return n << shift, nil
+}
+
+// zero values keep the runtime settings: gogc=0 leaves GOGC unchanged,
+// an empty memLimit leaves GOMEMLIMIT unchanged
+func WithGCTuning(ballastMiB int, gogc int, memLimit string) Option {
+	return func(options *options) error {
+		if ballastMiB < 0 {
+			return fmt.Errorf("ballast cannot be less than zero")
+		}
+		g := &gcTuning{ballastmib: ballastMiB, gogc: gogc}
+		if memLimit != "" {
+			limit, err := parseMemLimit(memLimit)
+			if err != nil {
+				return err
+			}
+			g.memlimit = limit
+		}
+		options.gctuning = g
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// connections taken over through HijackRoute, invisible to http.Server.Shutdown
+type hijackRegistry struct {
+	mux   *http.ServeMux
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	// closed when the last connection is removed during drain
+	empty chan struct{}
+}
+
+func newHijackRegistry() *hijackRegistry {
+	return &hijackRegistry{
+		mux:   http.NewServeMux(),
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+func (h *hijackRegistry) add(c net.Conn) {
+	h.mu.Lock()
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+}
+
+func (h *hijackRegistry) remove(c net.Conn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	if len(h.conns) == 0 && h.empty != nil {
+		close(h.empty)
+		h.empty = nil
+	}
+	h.mu.Unlock()
+}
+
+// waits for hijacked handlers to return, closes what is left at the deadline
+func (h *hijackRegistry) drain(ctx context.Context) error {
+	h.mu.Lock()
+	if len(h.conns) == 0 {
+		h.mu.Unlock()
+		return nil
+	}
+	if h.empty == nil {
+		h.empty = make(chan struct{})
+	}
+	empty := h.empty
+	h.mu.Unlock()
+	select {
+	case <-empty:
+		return nil
+	case <-ctx.Done():
+	}
+	h.mu.Lock()
+	for c := range h.conns {
+		c.Close()
+	}
+	h.mu.Unlock()
+	return ctx.Err()
+}
+
+// sits where the handler is, so hijack routes pass the middleware chain
+// but not the handler timeout, whose writer cannot be hijacked
+func (h *hijackRegistry) dispatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler, pattern := h.mux.Handler(r); matchesPattern(pattern, r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeMux also returns a pattern for its trailing slash and path cleaning
+// redirects, those requests belong to the main handler
+func matchesPattern(pattern, path string) bool {
+	// drop a host (and method) before the path
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		return false
+	}
+	pattern = pattern[i:]
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return path == pattern
+}
+
+// requests matching pattern (http.ServeMux syntax) take over the raw connection;
+// ctx is canceled when shutdown starts, the connection is closed when fn returns
+// or forcibly at the shutdown deadline
+func (s *Server) HijackRoute(pattern string, fn func(ctx context.Context, conn net.Conn, rw *bufio.ReadWriter)) {
+	s.hijacks.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "connection cannot be hijacked")
+			return
+		}
+		s.hijacks.add(conn)
+		defer func() {
+			conn.Close()
+			s.hijacks.remove(conn)
+		}()
+		fn(r.Context(), conn, rw)
+	})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const header_incident_id = "X-Incident-ID"
+
+type incidentIDKey struct{}
+
+// set for the recovery response, empty elsewhere
+func IncidentIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(incidentIDKey{}).(string)
+	return id
+}
+
+// short random id quoted by users to support and found in the logs
+func newIncidentID() string {
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+func prefersHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/html") && !strings.Contains(accept, "application/json")
+}
+
+var incidentPage = template.Must(template.New("incident").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Status}}</title></head>
+<body>
+<h1>{{.Status}}</h1>
+<p>{{.Message}}</p>
+<p>Incident ID: <code>{{.ID}}</code></p>
+</body>
+</html>
+`))
+
+// error response of a built-in middleware for an unexpected failure, JSON or
+// HTML depending on Accept, with the incident id in the body and X-Incident-ID
+func writeIncident(w http.ResponseWriter, r *http.Request, code int, msg, id string) {
+	w.Header().Set(header_incident_id, id)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if prefersHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		incidentPage.Execute(w, struct {
+			Status  string
+			Message string
+			ID      string
+		}{fmt.Sprintf("%d %s", code, http.StatusText(code)), msg, id})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error      string `json:"error"`
+		IncidentID string `json:"incident_id"`
+	}{msg, id})
+}
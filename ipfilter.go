@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+type ipFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// deny wins over allow, an empty allow list admits everything not denied
+func (f *ipFilter) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range f.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ipFilter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := netip.ParseAddr(clientIP(r))
+		if err != nil || !f.permits(addr) {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requests from addresses outside allow or inside deny are answered with 403
+func WithIPFilter(allow, deny []netip.Prefix) Option {
+	return func(options *options) error {
+		for _, list := range [][]netip.Prefix{allow, deny} {
+			for _, p := range list {
+				if !p.IsValid() {
+					return fmt.Errorf("invalid ip filter prefix %q", p)
+				}
+			}
+		}
+		options.ipfilter = &ipFilter{
+			allow: masked(allow),
+			deny:  masked(deny),
+		}
+		return nil
+	}
+}
+
+func masked(prefixes []netip.Prefix) []netip.Prefix {
+	out := make([]netip.Prefix, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = p.Masked()
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+func (s *Server) listen() ([]net.Listener, error) {
+	if s.gracefulrestart {
+		if lns, ok, err := inheritedListeners(); ok {
+			return lns, err
+		}
+	}
+	controls := s.listenercontrol
+	shards := 1
+	if s.shards > 0 {
+		controls = append([]func(network, address string, c syscall.RawConn) error{reusePort}, controls...)
+		shards = s.shards
+	}
+	lc := net.ListenConfig{KeepAlive: s.tcpkeepalive}
+	if len(controls) > 0 {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			for _, control := range controls {
+				if err := control(network, address, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	lns := make([]net.Listener, 0, len(s.addrs)*shards)
+	for _, addr := range s.addrs {
+		for i := 0; i < shards; i++ {
+			ln, err := s.bind(&lc, addr)
+			if err != nil {
+				closeListeners(lns)
+				return nil, err
+			}
+			// further shards must share the port picked for port 0
+			addr = ln.Addr().String()
+			lns = append(lns, ln)
+		}
+	}
+	return lns, nil
+}
+
+// retries while the address is in use (TIME_WAIT, previous instance shutting down)
+func (s *Server) bind(lc *net.ListenConfig, addr string) (net.Listener, error) {
+	backoff := s.bindbackoff
+	for attempt := 1; ; attempt++ {
+		ln, err := lc.Listen(context.Background(), "tcp", addr)
+		if err == nil || attempt >= s.bindattempts || !isAddrInUse(err) {
+			return ln, err
+		}
+		s.logger.Warn("address in use, retrying bind",
+			"addr", addr, "attempt", attempt, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// attempts in total, the wait starts at backoff and doubles after each retry
+func WithBindRetry(attempts int, backoff time.Duration) Option {
+	return func(options *options) error {
+		if attempts < 1 {
+			return fmt.Errorf("bind attempts must be at least one")
+		}
+		if backoff <= 0 {
+			return fmt.Errorf("bind backoff must be greater than zero")
+		}
+		options.bindattempts = attempts
+		options.bindbackoff = backoff
+		return nil
+	}
+}
+
+// fn runs on every listening socket before it is bound, e.g. to set socket
+// options or attach an eBPF program loaded elsewhere
+func WithListenerControl(fn func(network, address string, c syscall.RawConn) error) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("undefined listener control")
+		}
+		options.listenercontrol = append(options.listenercontrol, fn)
+		return nil
+	}
+}
+
+// counts accepted connections per listener
+type countListener struct {
+	net.Listener
+	accepts *atomic.Uint64
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.accepts.Add(1)
+	}
+	return c, err
+}
+
+// n SO_REUSEPORT listeners per address, each with its own accept loop,
+// n=0 means one per CPU; the kernel spreads new connections across them
+func WithListenerShards(n int) Option {
+	return func(options *options) error {
+		if !reuseport_supported {
+			return fmt.Errorf("listener shards are not supported on this platform")
+		}
+		if n < 0 {
+			return fmt.Errorf("listener shards cannot be less than zero")
+		}
+		if n == 0 {
+			n = runtime.NumCPU()
+		}
+		options.shards = n
+		return nil
+	}
+}
+
+func closeListeners(lns []net.Listener) {
+	for _, ln := range lns {
+		ln.Close()
+	}
+}
+
+// accepts at most cap(sem) simultaneous connections, sem may be shared
+type limitListener struct {
+	net.Listener
+	sem   chan struct{}
+	done  chan struct{}
+	once  sync.Once
+	stats *stats
+}
+
+func newLimitListener(ln net.Listener, sem chan struct{}, st *stats) *limitListener {
+	return &limitListener{
+		Listener: ln,
+		sem:      sem,
+		done:     make(chan struct{}),
+		stats:    st,
+	}
+}
+
+func (l *limitListener) acquire() bool {
+	select {
+	case <-l.done:
+		return false
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+	l.stats.connlimithits.Add(1)
+	select {
+	case <-l.done:
+		return false
+	case l.sem <- struct{}{}:
+		return true
+	}
+}
+
+func (l *limitListener) release() {
+	<-l.sem
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if !l.acquire() {
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: l.release}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.once.Do(func() { close(l.done) })
+	return err
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// limits simultaneously open connections, further clients wait in the accept queue
+func WithMaxConnections(n int) Option {
+	return func(options *options) error {
+		if n <= 0 {
+			return fmt.Errorf("max connections must be greater than zero")
+		}
+		options.maxconnections = &n
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	state_serving     = "serving"
+	state_draining    = "draining"
+	state_maintenance = "maintenance"
+)
+
+// response headers for client-side balancing:
+// X-Server-State is serving, draining or maintenance,
+// X-Server-Load is in-flight requests divided by capacity, may exceed 1
+type loadHints struct {
+	capacity    int
+	stats       *stats
+	maintenance *maintenance
+	stopping    chan struct{}
+}
+
+func (l *loadHints) state() string {
+	select {
+	case <-l.stopping:
+		return state_draining
+	default:
+	}
+	if l.maintenance.on.Load() {
+		return state_maintenance
+	}
+	return state_serving
+}
+
+func (l *loadHints) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Server-State", l.state())
+		load := float64(l.stats.inflight.Load()) / float64(l.capacity)
+		h.Set("X-Server-Load", strconv.FormatFloat(load, 'f', 2, 64))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// capacity is the number of in-flight requests considered full load
+func WithLoadHints(capacity int) Option {
+	return func(options *options) error {
+		if capacity <= 0 {
+			return fmt.Errorf("load hints capacity must be greater than zero")
+		}
+		options.loadhints = &capacity
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const default_maintenance_retry_after = time.Duration(30 * time.Second)
+
+type MaintenanceConfig struct {
+	// Retry-After sent with the 503, 30s by default
+	RetryAfter time.Duration
+	// replaces the default JSON error body
+	Body        []byte
+	ContentType string
+	// served normally during maintenance, e.g. health checks;
+	// "/health" covers "/health" and "/health/..."
+	ExemptPaths []string
+}
+
+type maintenance struct {
+	on  atomic.Bool
+	cfg MaintenanceConfig
+}
+
+func (m *maintenance) middleware(next http.Handler) http.Handler {
+	retryafter := strconv.Itoa(int(m.cfg.RetryAfter.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.on.Load() || (len(m.cfg.ExemptPaths) > 0 && matchPath(m.cfg.ExemptPaths, r.URL.Path)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", retryafter)
+		if m.cfg.Body == nil {
+			writeError(w, http.StatusServiceUnavailable, "service under maintenance")
+			return
+		}
+		if m.cfg.ContentType != "" {
+			w.Header().Set("Content-Type", m.cfg.ContentType)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(m.cfg.Body)
+	})
+}
+
+// every request except the exempt paths is answered with 503 until ExitMaintenance
+func (s *Server) EnterMaintenance() {
+	s.maintenance.on.Store(true)
+}
+
+func (s *Server) ExitMaintenance() {
+	s.maintenance.on.Store(false)
+}
+
+func (s *Server) InMaintenance() bool {
+	return s.maintenance.on.Load()
+}
+
+// configures the response of EnterMaintenance
+func WithMaintenance(cfg MaintenanceConfig) Option {
+	return func(options *options) error {
+		if cfg.RetryAfter < 0 {
+			return fmt.Errorf("maintenance retry after cannot be less than zero")
+		}
+		if cfg.RetryAfter == 0 {
+			cfg.RetryAfter = default_maintenance_retry_after
+		}
+		options.maintenance = &cfg
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// MiddlewareLayer is one layer of the effective chain around the handler.
+type MiddlewareLayer struct {
+	Name string `json:"name"`
+	// hash of the layer settings, equal for equally configured servers;
+	// secrets such as keys and salts are not part of it. User middleware is
+	// identified by its registered or function name only
+	Settings string `json:"settings"`
+}
+
+// MiddlewareManifest is the approved chain, see WithMiddlewareManifest.
+type MiddlewareManifest struct {
+	Middleware []MiddlewareLayer `json:"middleware"`
+}
+
+type chainBuilder struct {
+	mws    []func(http.Handler) http.Handler
+	layers []MiddlewareLayer
+}
+
+func (b *chainBuilder) use(name, settings string, mw func(http.Handler) http.Handler) {
+	b.mws = append(b.mws, mw)
+	b.layers = append(b.layers, newMiddlewareLayer(name, settings))
+}
+
+func newMiddlewareLayer(name, settings string) MiddlewareLayer {
+	sum := sha256.Sum256([]byte(settings))
+	return MiddlewareLayer{Name: name, Settings: hex.EncodeToString(sum[:8])}
+}
+
+// the first difference between the chains, nil when they match
+func (m *MiddlewareManifest) compare(chain []MiddlewareLayer) error {
+	for i := 0; i < max(len(chain), len(m.Middleware)); i++ {
+		switch {
+		case i >= len(chain):
+			return fmt.Errorf("middleware chain lacks layer %d %q of the manifest", i, m.Middleware[i].Name)
+		case i >= len(m.Middleware):
+			return fmt.Errorf("middleware chain layer %d %q is not in the manifest", i, chain[i].Name)
+		case chain[i].Name != m.Middleware[i].Name:
+			return fmt.Errorf("middleware chain layer %d is %q, manifest has %q", i, chain[i].Name, m.Middleware[i].Name)
+		case chain[i].Settings != m.Middleware[i].Settings:
+			return fmt.Errorf("middleware chain layer %d %q settings differ from the manifest", i, chain[i].Name)
+		}
+	}
+	return nil
+}
+
+// outermost first, including the fixed layers around the handler
+func (s *Server) MiddlewareChain() []MiddlewareLayer {
+	return append([]MiddlewareLayer(nil), s.chain...)
+}
+
+// writes the effective chain as a manifest for WithMiddlewareManifest
+func (s *Server) ExportMiddlewareManifest(path string) error {
+	b, err := json.MarshalIndent(MiddlewareManifest{Middleware: s.chain}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// New fails unless the effective middleware chain, names, order and
+// settings, matches the manifest written by ExportMiddlewareManifest
+func WithMiddlewareManifest(path string) Option {
+	return func(options *options) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("middleware manifest: %w", err)
+		}
+		var m MiddlewareManifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("middleware manifest %s: %w", path, err)
+		}
+		options.middlewaremanifest = &m
+		return nil
+	}
+}
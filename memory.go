@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	default_memory_gc_threshold     = 0.80
+	default_memory_shed_threshold   = 0.90
+	default_memory_reject_threshold = 0.95
+	default_memory_interval         = time.Duration(time.Second)
+)
+
+type MemoryPressure int32
+
+const (
+	MemoryPressureNone MemoryPressure = iota
+	// a GC is forced on every check
+	MemoryPressureGC
+	// low priority requests are answered with 503
+	MemoryPressureShed
+	// new connections are closed right after accept
+	MemoryPressureReject
+)
+
+func (p MemoryPressure) String() string {
+	switch p {
+	case MemoryPressureNone:
+		return "none"
+	case MemoryPressureGC:
+		return "gc"
+	case MemoryPressureShed:
+		return "shed"
+	case MemoryPressureReject:
+		return "reject"
+	}
+	return fmt.Sprintf("MemoryPressure(%d)", int32(p))
+}
+
+// thresholds are fractions of Limit, zero values take the defaults
+type MemoryPressureConfig struct {
+	// bytes, the runtime memory limit (GOMEMLIMIT, WithGCTuning) when zero
+	Limit int64
+	// 0.80, 0.90 and 0.95 by default
+	GCThreshold     float64
+	ShedThreshold   float64
+	RejectThreshold float64
+	// how often memory use is read, 1s by default
+	Interval time.Duration
+	// requests shed under pressure, all of them when nil; health checks
+	// should not be low priority
+	LowPriority func(r *http.Request) bool
+}
+
+type memoryMonitor struct {
+	cfg    MemoryPressureConfig
+	level  atomic.Int32
+	logger *slog.Logger
+	stats  *stats
+}
+
+func (m *memoryMonitor) pressure() MemoryPressure {
+	return MemoryPressure(m.level.Load())
+}
+
+// memory counted against the runtime memory limit
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+func (m *memoryMonitor) limit() int64 {
+	if m.cfg.Limit > 0 {
+		return m.cfg.Limit
+	}
+	return debug.SetMemoryLimit(-1)
+}
+
+func (m *memoryMonitor) check() MemoryPressure {
+	limit := m.limit()
+	if limit <= 0 || limit == math.MaxInt64 {
+		return MemoryPressureNone
+	}
+	used := float64(memoryInUse()) / float64(limit)
+	switch {
+	case used >= m.cfg.RejectThreshold:
+		return MemoryPressureReject
+	case used >= m.cfg.ShedThreshold:
+		return MemoryPressureShed
+	case used >= m.cfg.GCThreshold:
+		return MemoryPressureGC
+	}
+	return MemoryPressureNone
+}
+
+// runs until done is closed, level changes are logged and published
+func (s *Server) monitorMemory(done <-chan struct{}) {
+	m := s.memory
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		level := m.check()
+		if level >= MemoryPressureGC {
+			runtime.GC()
+			level = m.check()
+		}
+		prev := MemoryPressure(m.level.Swap(int32(level)))
+		if level == prev {
+			continue
+		}
+		s.logger.Warn("memory pressure",
+			slog.String("level", level.String()),
+			slog.String("previous", prev.String()),
+			slog.Uint64("in_use", memoryInUse()),
+			slog.Int64("limit", m.limit()),
+		)
+		s.publish(EventMemoryPressure)
+	}
+}
+
+func (m *memoryMonitor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.pressure() >= MemoryPressureShed && (m.cfg.LowPriority == nil || m.cfg.LowPriority(r)) {
+			m.stats.memoryshed.Add(1)
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "server under memory pressure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type memoryListener struct {
+	net.Listener
+	monitor *memoryMonitor
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil || l.monitor.pressure() < MemoryPressureReject {
+			return c, err
+		}
+		l.monitor.stats.memoryrejected.Add(1)
+		c.Close()
+	}
+}
+
+// current level, MemoryPressureNone without WithMemoryPressure
+func (s *Server) MemoryPressure() MemoryPressure {
+	if s.memory == nil {
+		return MemoryPressureNone
+	}
+	return s.memory.pressure()
+}
+
+// watches memory use against the memory limit and reacts in stages before the
+// process is OOM-killed: forces GC, sheds low priority requests with 503 and
+// finally closes new connections
+func WithMemoryPressure(cfg MemoryPressureConfig) Option {
+	return func(options *options) error {
+		if cfg.Limit < 0 {
+			return fmt.Errorf("memory pressure limit cannot be less than zero")
+		}
+		if cfg.Interval < 0 {
+			return fmt.Errorf("memory pressure interval cannot be less than zero")
+		}
+		if cfg.Interval == 0 {
+			cfg.Interval = default_memory_interval
+		}
+		if cfg.GCThreshold == 0 {
+			cfg.GCThreshold = default_memory_gc_threshold
+		}
+		if cfg.ShedThreshold == 0 {
+			cfg.ShedThreshold = default_memory_shed_threshold
+		}
+		if cfg.RejectThreshold == 0 {
+			cfg.RejectThreshold = default_memory_reject_threshold
+		}
+		if cfg.GCThreshold < 0 || cfg.GCThreshold > cfg.ShedThreshold ||
+			cfg.ShedThreshold > cfg.RejectThreshold || cfg.RejectThreshold > 1 {
+			return fmt.Errorf("memory pressure thresholds must satisfy 0 < gc <= shed <= reject <= 1")
+		}
+		options.memorypressure = &cfg
+		return nil
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+)
+
+// first middleware is the outermost
+func chain(handler http.Handler, mws ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return handler
+}
+
+// applied around the handler in the given order, the first one is the outermost;
+// built-in layers (access log etc.) wrap the user middleware
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(options *options) error {
+		for _, m := range mw {
+			if m == nil {
+				return fmt.Errorf("undefined middleware")
+			}
+		}
+		for _, m := range mw {
+			options.middleware = append(options.middleware, m)
+			options.middlewarenames = append(options.middlewarenames, funcName(m))
+		}
+		return nil
+	}
+}
+
+// package qualified name of fn, e.g. "example.com/app/mw.Logging" or
+// "example.com/app/mw.Logging.func1" for a closure it returns; it names the
+// layer in MiddlewareChain
+func funcName(fn func(http.Handler) http.Handler) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "custom"
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type scopeKey struct{}
+
+// cleanups run when the handler returns
+type requestScope struct {
+	mu       sync.Mutex
+	cleanups []func()
+}
+
+func (sc *requestScope) add(fn func()) {
+	sc.mu.Lock()
+	sc.cleanups = append(sc.cleanups, fn)
+	sc.mu.Unlock()
+}
+
+func (sc *requestScope) close() {
+	sc.mu.Lock()
+	cleanups := sc.cleanups
+	sc.cleanups = nil
+	sc.mu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
+
+func requestScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc := &requestScope{}
+		defer sc.close()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeKey{}, sc)))
+	})
+}
+
+// Pool is a typed sync.Pool whose objects are returned automatically
+// when the request they were taken for completes.
+type Pool[T any] struct {
+	pool  sync.Pool
+	reset func(*T)
+}
+
+// reset is called before an object goes back to the pool, may be nil
+func NewPool[T any](alloc func() *T, reset func(*T)) *Pool[T] {
+	return &Pool[T]{
+		pool:  sync.Pool{New: func() any { return alloc() }},
+		reset: reset,
+	}
+}
+
+// the object must not be used after the handler returns; outside of a
+// request served by Server it is not returned automatically, use Put
+func (p *Pool[T]) Get(ctx context.Context) *T {
+	v := p.pool.Get().(*T)
+	if sc, ok := ctx.Value(scopeKey{}).(*requestScope); ok {
+		sc.add(func() { p.Put(v) })
+	}
+	return v
+}
+
+func (p *Pool[T]) Put(v *T) {
+	if p.reset != nil {
+		p.reset(v)
+	}
+	p.pool.Put(v)
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	default_proxy_header_timeout = time.Duration(5 * time.Second)
+	proxy_v1_max_length          = 107
+)
+
+var proxy_v2_signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+type proxyProtocol struct {
+	timeout time.Duration
+	sources []netip.Prefix
+}
+
+func (p *proxyProtocol) allowed(addr net.Addr) bool {
+	if len(p.sources) == 0 {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	for _, prefix := range p.sources {
+		if prefix.Contains(ap.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyListener struct {
+	net.Listener
+	proto *proxyProtocol
+}
+
+// the header is parsed lazily on the connection goroutine, not in Accept
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.proto.allowed(c.RemoteAddr()) {
+		return c, nil
+	}
+	return &proxyConn{Conn: c, reader: bufio.NewReader(c), timeout: l.proto.timeout}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once     sync.Once
+	err      error
+	remote   net.Addr
+	local    net.Addr
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.err = c.readHeader()
+		c.mu.Lock()
+		c.Conn.SetReadDeadline(c.deadline)
+		c.mu.Unlock()
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.init()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// deadlines set by the server are restored once the header is read
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// a connection without a header is served as is
+func (c *proxyConn) readHeader() error {
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	switch first[0] {
+	case 'P':
+		return c.readV1()
+	case proxy_v2_signature[0]:
+		sig, err := c.reader.Peek(len(proxy_v2_signature))
+		if err != nil || !bytes.Equal(sig, proxy_v2_signature) {
+			return nil
+		}
+		return c.readV2()
+	}
+	return nil
+}
+
+// PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n
+func (c *proxyConn) readV1() error {
+	prefix, err := c.reader.Peek(6)
+	if err != nil || string(prefix) != "PROXY " {
+		return nil
+	}
+	var line []byte
+	for len(line) < proxy_v1_max_length {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return fmt.Errorf("proxy protocol: v1 header too long")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("proxy protocol: invalid v1 header")
+	}
+	src, err := parseProxyAddr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := parseProxyAddr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+	c.remote, c.local = src, dst
+	return nil
+}
+
+func parseProxyAddr(ip, port string) (*net.TCPAddr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: invalid address %q", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: invalid port %q", port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(p))), nil
+}
+
+func (c *proxyConn) readV2() error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(c.reader, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[12]>>4 != 2 {
+		return fmt.Errorf("proxy protocol: unsupported version %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return err
+	}
+	// LOCAL command, e.g. health checks of the proxy itself
+	if hdr[12]&0x0f == 0 {
+		return nil
+	}
+	var iplen int
+	switch hdr[13] >> 4 {
+	case 1:
+		iplen = 4
+	case 2:
+		iplen = 16
+	default:
+		return nil
+	}
+	if len(body) < 2*iplen+4 {
+		return fmt.Errorf("proxy protocol: short v2 address block")
+	}
+	srcip, _ := netip.AddrFromSlice(body[:iplen])
+	dstip, _ := netip.AddrFromSlice(body[iplen : 2*iplen])
+	srcport := binary.BigEndian.Uint16(body[2*iplen:])
+	dstport := binary.BigEndian.Uint16(body[2*iplen+2:])
+	c.remote = net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcip, srcport))
+	c.local = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstip, dstport))
+	return nil
+}
+
+// parses PROXY protocol v1/v2 headers so RemoteAddr is the real client;
+// without WithProxyProtocolSources any client can choose its address, so
+// options relying on the client IP then require sources
+func WithProxyProtocol() Option {
+	return func(options *options) error {
+		if options.proxyprotocol == nil {
+			options.proxyprotocol = &proxyProtocol{timeout: default_proxy_header_timeout}
+		}
+		return nil
+	}
+}
+
+func WithProxyProtocolTimeout(timeout time.Duration) Option {
+	return func(options *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("proxy protocol timeout must be greater than zero")
+		}
+		WithProxyProtocol()(options)
+		options.proxyprotocol.timeout = timeout
+		return nil
+	}
+}
+
+// only these peers may send a PROXY header, others are served as is
+func WithProxyProtocolSources(sources []netip.Prefix) Option {
+	return func(options *options) error {
+		for _, p := range sources {
+			if !p.IsValid() {
+				return fmt.Errorf("invalid proxy protocol source %q", p)
+			}
+		}
+		WithProxyProtocol()(options)
+		options.proxyprotocol.sources = append(options.proxyprotocol.sources, masked(sources)...)
+		return nil
+	}
+}
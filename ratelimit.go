@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const rate_limit_sweep_interval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// token bucket per client key
+type rateLimiter struct {
+	rps   float64
+	burst float64
+	key   func(r *http.Request) string
+	stats *stats
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// reports whether a request is allowed and, if not, when a token is available
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > rate_limit_sweep_interval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rps)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rps * float64(time.Second))
+}
+
+// drops buckets that have refilled completely, they are equal to new ones
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rps >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(l.key(r), time.Now())
+		if !ok {
+			l.stats.ratelimited.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// token bucket limit per client IP, exceeding clients get 429 with Retry-After
+func WithRateLimit(rps float64, burst int) Option {
+	return func(options *options) error {
+		if rps <= 0 {
+			return fmt.Errorf("rate limit must be greater than zero")
+		}
+		if burst < 1 {
+			return fmt.Errorf("rate limit burst must be at least one")
+		}
+		options.ratelimit = &rps
+		options.ratelimitburst = burst
+		return nil
+	}
+}
+
+// replaces the client IP as the rate limit key, e.g. with an API key or user
+func WithRateLimitKey(key func(r *http.Request) string) Option {
+	return func(options *options) error {
+		if key == nil {
+			return fmt.Errorf("undefined rate limit key")
+		}
+		options.ratelimitkey = key
+		return nil
+	}
+}
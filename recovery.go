@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+type recovery struct {
+	logger   *slog.Logger
+	stats    *stats
+	response func(w http.ResponseWriter, r *http.Request, err any)
+}
+
+func (rc *recovery) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseWriter(w)
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			rc.stats.panics.Add(1)
+			id := newIncidentID()
+			rc.logger.ErrorContext(r.Context(), "panic recovered",
+				slog.String("incident_id", id),
+				slog.Any("error", err),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if rw.status != 0 {
+				// headers are already sent, cut the connection so the client
+				// cannot mistake the partial body for a complete response
+				panic(http.ErrAbortHandler)
+			}
+			rw.Header().Set(header_incident_id, id)
+			rc.response(rw, r.WithContext(context.WithValue(r.Context(), incidentIDKey{}, id)), err)
+		}()
+		next.ServeHTTP(expose(rw), r)
+	})
+}
+
+func defaultRecoveryResponse(w http.ResponseWriter, r *http.Request, _ any) {
+	writeIncident(w, r, http.StatusInternalServerError, "internal server error", IncidentIDFromContext(r.Context()))
+}
+
+// handler panics are logged with the stack trace and answered with 500
+func WithRecovery() Option {
+	return func(options *options) error {
+		options.recovery = true
+		return nil
+	}
+}
+
+// customizes the response written after a recovered panic, the incident id
+// logged with it is in IncidentIDFromContext and the X-Incident-ID header
+func WithRecoveryResponse(fn func(w http.ResponseWriter, r *http.Request, err any)) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("undefined recovery response")
+		}
+		options.recovery = true
+		options.recoveryresponse = fn
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// only middleware is registered by name: the server has no health check or
+// codec extension points, and event sinks are passed to WithEvents directly
+var registry = struct {
+	sync.RWMutex
+	middleware map[string]func(http.Handler) http.Handler
+}{
+	middleware: make(map[string]func(http.Handler) http.Handler),
+}
+
+// built-in layers addressable by name; their position in the chain is fixed
+var builtin_middleware = map[string]func() Option{
+	"recovery":   WithRecovery,
+	"request_id": WithRequestID,
+}
+
+// makes middleware available to WithNamedMiddleware, intended to be called from init
+func RegisterMiddleware(name string, mw func(http.Handler) http.Handler) error {
+	if name == "" {
+		return fmt.Errorf("empty middleware name")
+	}
+	if mw == nil {
+		return fmt.Errorf("undefined middleware %q", name)
+	}
+	if _, ok := builtin_middleware[name]; ok {
+		return fmt.Errorf("middleware %q is built-in", name)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.middleware[name]; ok {
+		return fmt.Errorf("middleware %q already registered", name)
+	}
+	registry.middleware[name] = mw
+	return nil
+}
+
+func RegisteredMiddleware() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(builtin_middleware)+len(registry.middleware))
+	for name := range builtin_middleware {
+		names = append(names, name)
+	}
+	for name := range registry.middleware {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolves middleware by name, e.g. WithNamedMiddleware("recovery", "mycorp.auth")
+func WithNamedMiddleware(names ...string) Option {
+	return func(options *options) error {
+		for _, name := range names {
+			if opt, ok := builtin_middleware[name]; ok {
+				if err := opt()(options); err != nil {
+					return err
+				}
+				continue
+			}
+			registry.RLock()
+			mw, ok := registry.middleware[name]
+			registry.RUnlock()
+			if !ok {
+				return fmt.Errorf("unknown middleware %q", name)
+			}
+			options.middleware = append(options.middleware, mw)
+			options.middlewarenames = append(options.middlewarenames, name)
+		}
+		return nil
+	}
+}
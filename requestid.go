@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const (
+	header_request_id     = "X-Request-ID"
+	max_request_id_length = 128
+)
+
+type requestIDKey struct{}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header_request_id)
+		if !validRequestID(id) {
+			id = newUUID()
+		}
+		w.Header().Set(header_request_id, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// incoming ids end up in logs, so only a safe subset is accepted
+func validRequestID(id string) bool {
+	if id == "" || len(id) > max_request_id_length {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// takes X-Request-ID from the request or generates one, see RequestIDFromContext
+func WithRequestID() Option {
+	return func(options *options) error {
+		options.requestid = true
+		return nil
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// returned by Write once a response exceeds its WithResponseSizeLimit
+var ErrResponseTooLarge = errors.New("response size limit exceeded")
+
+type responseSizeLimit struct {
+	path  string
+	limit int64
+}
+
+type responseSizeLimits struct {
+	limits []responseSizeLimit
+	logger *slog.Logger
+}
+
+// the limit of the longest matching path
+func (l *responseSizeLimits) lookup(path string) (int64, bool) {
+	var best responseSizeLimit
+	found := false
+	for _, rl := range l.limits {
+		if matchPath([]string{rl.path}, path) && (!found || len(rl.path) > len(best.path)) {
+			best, found = rl, true
+		}
+	}
+	return best.limit, found
+}
+
+type limitedResponseWriter struct {
+	*responseWriter
+	limit    int64
+	exceeded bool
+}
+
+func (w *limitedResponseWriter) Write(b []byte) (int, error) {
+	if w.exceeded || w.bytes+int64(len(b)) > w.limit {
+		w.exceeded = true
+		return 0, ErrResponseTooLarge
+	}
+	return w.responseWriter.Write(b)
+}
+
+// through Write, so the limit applies
+func (w *limitedResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(writerOnly{w}, src)
+}
+
+func (l *responseSizeLimits) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := l.lookup(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lw := &limitedResponseWriter{responseWriter: newResponseWriter(w), limit: limit}
+		next.ServeHTTP(expose(lw), r)
+		if !lw.exceeded {
+			return
+		}
+		id := newIncidentID()
+		l.logger.ErrorContext(r.Context(), "response size limit exceeded",
+			slog.String("incident_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+			slog.Int64("limit", limit),
+			slog.Int64("written", lw.bytes),
+		)
+		if lw.status == 0 {
+			writeIncident(w, r, http.StatusInternalServerError, "response too large", id)
+			return
+		}
+		// part of the body is sent, cut the connection so the client
+		// cannot mistake it for a complete response
+		panic(http.ErrAbortHandler)
+	})
+}
+
+// responses under path ("/export" covers "/export/...") may be at most limit
+// bytes, the most specific path wins; writes past it fail with
+// ErrResponseTooLarge and the request ends in a 500 or a closed connection
+func WithResponseSizeLimit(path string, limit int64) Option {
+	return func(options *options) error {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("response size limit path must start with /")
+		}
+		if limit <= 0 {
+			return fmt.Errorf("response size limit must be greater than zero")
+		}
+		options.responsesizelimits = append(options.responsesizelimits, responseSizeLimit{path: path, limit: limit})
+		return nil
+	}
+}
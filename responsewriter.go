@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+func (rw *responseWriter) Flush() {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// keeps the sendfile path of http.ServeContent
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{rw.ResponseWriter}, src)
+	}
+	rw.bytes += n
+	return n, err
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// hides ReadFrom so io.Copy does not recurse into it
+type writerOnly struct {
+	io.Writer
+}
+
+// a wrapper implementing every optional interface, expose hides the ones
+// the wrapped writer lacks
+type responseWrapper interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	io.ReaderFrom
+	Unwrap() http.ResponseWriter
+}
+
+type unwrapper interface {
+	http.ResponseWriter
+	Unwrap() http.ResponseWriter
+}
+
+// w as seen by the next handler: Flusher, Hijacker and ReaderFrom only when
+// the writer w wraps has them, so handler type assertions keep working
+func expose(w responseWrapper) http.ResponseWriter {
+	under := w.Unwrap()
+	_, f := under.(http.Flusher)
+	_, h := under.(http.Hijacker)
+	_, r := under.(io.ReaderFrom)
+	switch {
+	case f && h && r:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{w, w, w, w}
+	case f && h:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+		}{w, w, w}
+	case f && r:
+		return struct {
+			unwrapper
+			http.Flusher
+			io.ReaderFrom
+		}{w, w, w}
+	case h && r:
+		return struct {
+			unwrapper
+			http.Hijacker
+			io.ReaderFrom
+		}{w, w, w}
+	case f:
+		return struct {
+			unwrapper
+			http.Flusher
+		}{w, w}
+	case h:
+		return struct {
+			unwrapper
+			http.Hijacker
+		}{w, w}
+	case r:
+		return struct {
+			unwrapper
+			io.ReaderFrom
+		}{w, w}
+	}
+	return struct{ unwrapper }{w}
+}
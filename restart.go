@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+const (
+	env_inherited_fds = "SERVER_HTTP_INHERITED_FDS"
+	env_parent_pid    = "SERVER_HTTP_PARENT_PID"
+	// first descriptor after stdin, stdout and stderr
+	inherited_fd_start = 3
+)
+
+// listeners passed by the parent process on a graceful restart, if any
+func inheritedListeners() ([]net.Listener, bool, error) {
+	n := os.Getenv(env_inherited_fds)
+	if n == "" {
+		return nil, false, nil
+	}
+	os.Unsetenv(env_inherited_fds)
+	count, err := strconv.Atoi(n)
+	if err != nil || count < 1 {
+		return nil, true, fmt.Errorf("invalid %s=%q", env_inherited_fds, n)
+	}
+	lns := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		f := os.NewFile(uintptr(inherited_fd_start+i), "listener")
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			closeListeners(lns)
+			return nil, true, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, true, nil
+}
+
+// on SIGUSR2 the running binary is re-executed with the listening socket;
+// once the new process is ready it stops this one through the regular
+// graceful shutdown (not supported on Windows)
+func WithGracefulRestart() Option {
+	return func(options *options) error {
+		if restart_signal == nil {
+			return fmt.Errorf("graceful restart is not supported on this platform")
+		}
+		options.gracefulrestart = true
+		return nil
+	}
+}
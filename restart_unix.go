@@ -0,0 +1,65 @@
+//go:build !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+var restart_signal os.Signal = syscall.SIGUSR2
+
+// starts a copy of the running binary sharing the listening sockets
+func (s *Server) upgrade(lns []net.Listener) error {
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	defer func() {
+		for _, f := range files[inherited_fd_start:] {
+			f.Close()
+		}
+	}()
+	for _, ln := range lns {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %T cannot be passed to a child process", ln)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env := append(os.Environ(),
+		env_inherited_fds+"="+strconv.Itoa(len(lns)),
+		env_parent_pid+"="+strconv.Itoa(os.Getpid()),
+	)
+	p, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: files,
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Info("graceful restart, child started", "pid", p.Pid)
+	return p.Release()
+}
+
+// asks the parent of a graceful restart to drain and exit
+func notifyParent() error {
+	pid := os.Getenv(env_parent_pid)
+	if pid == "" {
+		return nil
+	}
+	os.Unsetenv(env_parent_pid)
+	ppid, err := strconv.Atoi(pid)
+	if err != nil || ppid != os.Getppid() {
+		return nil
+	}
+	return syscall.Kill(ppid, syscall.SIGTERM)
+}
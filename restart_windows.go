@@ -0,0 +1,19 @@
+//go:build windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+var restart_signal os.Signal
+
+func (s *Server) upgrade(lns []net.Listener) error {
+	return fmt.Errorf("graceful restart is not supported on windows")
+}
+
+func notifyParent() error {
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package server
+
+import "syscall"
+
+const so_reuseport = syscall.SO_REUSEPORT
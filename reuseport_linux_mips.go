@@ -0,0 +1,6 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+
+package server
+
+// missing from the frozen syscall package
+const so_reuseport = 0x200
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package server
+
+import "syscall"
+
+const reuseport_supported = false
+
+var reusePort func(network, address string, c syscall.RawConn) error
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	default_route_breaker_error_rate   = 0.5
+	default_route_breaker_min_requests = 20
+	default_route_breaker_window       = time.Duration(10 * time.Second)
+	default_route_breaker_open_for     = time.Duration(30 * time.Second)
+)
+
+// zero values take the defaults
+type RouteBreakerConfig struct {
+	// path prefixes with their own error budget, the longest match wins;
+	// "/api/search" covers "/api/search" and "/api/search/..."
+	Routes []string
+	// share of 5xx responses in a window that opens the route, 0.5 by default
+	ErrorRate float64
+	// windows with fewer requests never open the route, 20 by default
+	MinRequests int
+	// 10s by default
+	Window time.Duration
+	// how long an opened route answers 503, sent as Retry-After; 30s by default
+	OpenFor time.Duration
+}
+
+type routeState struct {
+	mu        sync.Mutex
+	start     time.Time
+	requests  int
+	failures  int
+	openuntil time.Time
+	// opened by OpenRoute, stays open until CloseRoute
+	forced bool
+}
+
+type routeBreaker struct {
+	cfg    RouteBreakerConfig
+	routes map[string]*routeState
+	logger *slog.Logger
+	stats  *stats
+}
+
+func newRouteBreaker(cfg RouteBreakerConfig, logger *slog.Logger, st *stats) *routeBreaker {
+	rb := &routeBreaker{cfg: cfg, routes: make(map[string]*routeState), logger: logger, stats: st}
+	for _, route := range cfg.Routes {
+		rb.routes[route] = &routeState{}
+	}
+	return rb
+}
+
+func (rb *routeBreaker) match(path string) (string, *routeState) {
+	var route string
+	for _, p := range rb.cfg.Routes {
+		if len(p) > len(route) && matchPath([]string{p}, path) {
+			route = p
+		}
+	}
+	return route, rb.routes[route]
+}
+
+// zero when the route is closed
+func (rs *routeState) retryAfter(now time.Time, openfor time.Duration) time.Duration {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.forced {
+		return openfor
+	}
+	return rs.openuntil.Sub(now)
+}
+
+func (rb *routeBreaker) record(route string, rs *routeState, failed bool) {
+	now := time.Now()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.forced || now.Before(rs.openuntil) {
+		// answered before the route was opened
+		return
+	}
+	if now.Sub(rs.start) >= rb.cfg.Window {
+		rs.start, rs.requests, rs.failures = now, 0, 0
+	}
+	rs.requests++
+	if failed {
+		rs.failures++
+	}
+	if rs.requests < rb.cfg.MinRequests || float64(rs.failures) < rb.cfg.ErrorRate*float64(rs.requests) {
+		return
+	}
+	rb.logger.Warn("route opened",
+		slog.String("route", route),
+		slog.Int("requests", rs.requests),
+		slog.Int("failures", rs.failures),
+		slog.Duration("open_for", rb.cfg.OpenFor),
+	)
+	rs.openuntil = now.Add(rb.cfg.OpenFor)
+	rs.start, rs.requests, rs.failures = time.Time{}, 0, 0
+}
+
+func (rb *routeBreaker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, rs := rb.match(r.URL.Path)
+		if rs == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wait := rs.retryAfter(time.Now(), rb.cfg.OpenFor); wait > 0 {
+			rb.stats.routebreakerrejected.Add(1)
+			// rounded up, a client retrying on time finds the route closed
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			writeError(w, http.StatusServiceUnavailable, "route temporarily unavailable")
+			return
+		}
+		rw := newResponseWriter(w)
+		defer func() {
+			if err := recover(); err != nil {
+				rb.record(route, rs, true)
+				panic(err)
+			}
+			rb.record(route, rs, rw.Status() >= 500)
+		}()
+		next.ServeHTTP(expose(rw), r)
+	})
+}
+
+func (s *Server) routeState(route string) (*routeState, error) {
+	if s.routebreaker == nil {
+		return nil, fmt.Errorf("route breaker is not enabled")
+	}
+	rs, ok := s.routebreaker.routes[route]
+	if !ok {
+		return nil, fmt.Errorf("route %q is not in the route breaker routes", route)
+	}
+	return rs, nil
+}
+
+// every request of the route is answered with 503 until CloseRoute
+func (s *Server) OpenRoute(route string) error {
+	rs, err := s.routeState(route)
+	if err != nil {
+		return err
+	}
+	rs.mu.Lock()
+	rs.forced = true
+	rs.mu.Unlock()
+	return nil
+}
+
+// closes a route opened by OpenRoute or by its error rate, starting a fresh window
+func (s *Server) CloseRoute(route string) error {
+	rs, err := s.routeState(route)
+	if err != nil {
+		return err
+	}
+	rs.mu.Lock()
+	rs.forced = false
+	rs.openuntil = time.Time{}
+	rs.start, rs.requests, rs.failures = time.Time{}, 0, 0
+	rs.mu.Unlock()
+	return nil
+}
+
+// routes currently answered with 503, nil without WithRouteBreaker
+func (s *Server) OpenRoutes() []string {
+	if s.routebreaker == nil {
+		return nil
+	}
+	var open []string
+	now := time.Now()
+	for _, route := range s.routebreaker.cfg.Routes {
+		if s.routebreaker.routes[route].retryAfter(now, s.routebreaker.cfg.OpenFor) > 0 {
+			open = append(open, route)
+		}
+	}
+	return open
+}
+
+// answers a route with 503 and Retry-After for OpenFor once its share of 5xx
+// responses in a window reaches ErrorRate, sparing whatever it depends on;
+// OpenRoute and CloseRoute override it
+func WithRouteBreaker(cfg RouteBreakerConfig) Option {
+	return func(options *options) error {
+		if len(cfg.Routes) == 0 {
+			return fmt.Errorf("no route breaker routes")
+		}
+		for i, route := range cfg.Routes {
+			if !strings.HasPrefix(route, "/") {
+				return fmt.Errorf("route breaker route %q must start with /", route)
+			}
+			if slices.Contains(cfg.Routes[:i], route) {
+				return fmt.Errorf("duplicate route breaker route %q", route)
+			}
+		}
+		if cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+			return fmt.Errorf("route breaker error rate must be between 0 and 1")
+		}
+		if cfg.MinRequests < 0 {
+			return fmt.Errorf("route breaker min requests cannot be less than zero")
+		}
+		if cfg.Window < 0 || cfg.OpenFor < 0 {
+			return fmt.Errorf("route breaker window and open for cannot be less than zero")
+		}
+		if cfg.ErrorRate == 0 {
+			cfg.ErrorRate = default_route_breaker_error_rate
+		}
+		if cfg.MinRequests == 0 {
+			cfg.MinRequests = default_route_breaker_min_requests
+		}
+		if cfg.Window == 0 {
+			cfg.Window = default_route_breaker_window
+		}
+		if cfg.OpenFor == 0 {
+			cfg.OpenFor = default_route_breaker_open_for
+		}
+		cfg.Routes = slices.Clone(cfg.Routes)
+		options.routebreaker = &cfg
+		return nil
+	}
+}
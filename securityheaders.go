@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	default_hsts_max_age            = time.Duration(365 * 24 * time.Hour)
+	default_frame_options           = "DENY"
+	default_referrer_policy         = "strict-origin-when-cross-origin"
+	default_content_security_policy = "default-src 'self'"
+)
+
+// zero values use the defaults
+type SecurityHeadersConfig struct {
+	// Strict-Transport-Security max-age, one year by default
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// X-Frame-Options, DENY by default
+	FrameOptions string
+	// Referrer-Policy, strict-origin-when-cross-origin by default
+	ReferrerPolicy string
+	// Content-Security-Policy, default-src 'self' by default
+	ContentSecurityPolicy string
+	// header names to leave out, e.g. "Content-Security-Policy"
+	Disable []string
+}
+
+func securityHeaders(cfg SecurityHeadersConfig) http.Header {
+	maxage := cfg.HSTSMaxAge
+	if maxage == 0 {
+		maxage = default_hsts_max_age
+	}
+	hsts := fmt.Sprintf("max-age=%d", int64(maxage.Seconds()))
+	if cfg.HSTSIncludeSubdomains {
+		hsts += "; includeSubDomains"
+	}
+	if cfg.HSTSPreload {
+		hsts += "; preload"
+	}
+	h := http.Header{}
+	h.Set("Strict-Transport-Security", hsts)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Frame-Options", orDefault(cfg.FrameOptions, default_frame_options))
+	h.Set("Referrer-Policy", orDefault(cfg.ReferrerPolicy, default_referrer_policy))
+	h.Set("Content-Security-Policy", orDefault(cfg.ContentSecurityPolicy, default_content_security_policy))
+	for _, name := range cfg.Disable {
+		h.Del(name)
+	}
+	return h
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// headers are set before the handler runs, so handlers can still override them
+func securityHeadersMiddleware(headers http.Header) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for name, values := range headers {
+				h[name] = append([]string(nil), values...)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HSTS, X-Content-Type-Options, X-Frame-Options, Referrer-Policy and
+// Content-Security-Policy on every response
+func WithSecurityHeaders(cfg SecurityHeadersConfig) Option {
+	return func(options *options) error {
+		if cfg.HSTSMaxAge < 0 {
+			return fmt.Errorf("hsts max age cannot be less than zero")
+		}
+		known := securityHeaders(SecurityHeadersConfig{})
+		for _, name := range cfg.Disable {
+			if _, ok := known[http.CanonicalHeaderKey(name)]; !ok {
+				return fmt.Errorf("unknown security header %q", name)
+			}
+		}
+		options.securityheaders = securityHeaders(cfg)
+		return nil
+	}
+}
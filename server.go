@@ -2,11 +2,20 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -14,34 +23,189 @@ import (
 type Option func(option *options) error
 
 type options struct {
+	addr           *string
+	addresses      []string
 	host           *string
 	port           *string
 	maxheaderbytes *int
 	writetimeout   *time.Duration
 	readtimeout    *time.Duration
 	idletimeout    *time.Duration
+
+	readheadertimeout *time.Duration
+	shutdowntimeout   *time.Duration
+
+	keepalivesdisabled           bool
+	disablegeneraloptionshandler bool
+
+	tcpkeepalive *time.Duration
+	connstate    func(net.Conn, http.ConnState)
+	conncontext  func(ctx context.Context, c net.Conn) context.Context
+	basecontext  []func(ctx context.Context) context.Context
+	shards       int
+
+	listenercontrol []func(network, address string, c syscall.RawConn) error
+
+	bindattempts int
+	bindbackoff  time.Duration
+
+	tlscertfile string
+	tlskeyfile  string
+
+	accesslog       *slog.Logger
+	commonlog       io.Writer
+	accesslogsample *float64
+	accesslogskip   []string
+
+	errorlog *slog.Logger
+
+	middleware []func(http.Handler) http.Handler
+	// parallel to middleware, the registered or function name
+	middlewarenames    []string
+	middlewaremanifest *MiddlewareManifest
+
+	requestid bool
+
+	maxbodybytes *int64
+
+	responsesizelimits []responseSizeLimit
+
+	maxconnections *int
+
+	bandwidthlimit *bandwidthLimit
+
+	trustedproxies trustedProxies
+	ipfilter       *ipFilter
+	cors           *cors
+
+	clientfingerprint *clientFingerprint
+
+	securityheaders http.Header
+
+	compression *compressor
+
+	maintenance *MaintenanceConfig
+
+	events EventBus
+
+	shadow *ShadowConfig
+
+	topology        *Topology
+	topologyheaders bool
+
+	loadhints *int
+
+	auth []*authGuard
+
+	shutdownreport *slog.Logger
+
+	draincoordinator *drainCoordinator
+
+	gracefulrestart bool
+
+	gctuning *gcTuning
+
+	memorypressure *MemoryPressureConfig
+
+	proxyprotocol *proxyProtocol
+
+	ratelimit      *float64
+	ratelimitburst int
+	ratelimitkey   func(r *http.Request) string
+
+	routebreaker *RouteBreakerConfig
+
+	handlertimeout    *time.Duration
+	handlertimeoutmsg string
+
+	recovery         bool
+	recoveryresponse func(w http.ResponseWriter, r *http.Request, err any)
 }
 
 const (
 	default_write_timeout = time.Duration(15 * time.Second)
 	default_read_timeout  = time.Duration(15 * time.Second)
 	default_idle_timeout  = time.Duration(60 * time.Second)
+
+	default_read_header_timeout = time.Duration(5 * time.Second)
+	default_shutdown_timeout    = time.Duration(15 * time.Second)
 )
 
 type Server struct {
 	*http.Server
+	stats     *stats
+	ready     chan struct{}
+	addrs     []string
+	listeners []net.Listener
+
+	tcpkeepalive time.Duration
+	shards       int
+
+	listenercontrol []func(network, address string, c syscall.RawConn) error
+
+	bindattempts int
+	bindbackoff  time.Duration
+
+	// shared by all listeners, see WithMaxConnections
+	connsem chan struct{}
+
+	bandwidthlimit *bandwidthLimit
+
+	gctuning *gcTuning
+	ballast  []byte
+
+	memory *memoryMonitor
+
+	proxyprotocol *proxyProtocol
+
+	logger *slog.Logger
+
+	gracefulrestart bool
+	rawlisteners    []net.Listener
+
+	hijacks      *hijackRegistry
+	maintenance  *maintenance
+	routebreaker *routeBreaker
+	events       EventBus
+	topology     Topology
+
+	draincoordinator *drainCoordinator
+
+	// effective middleware, outermost first
+	chain []MiddlewareLayer
+
+	shutdowntimeout time.Duration
+	// effective timeout of StartWithAwaitStop, read after ready
+	stoptimeout time.Duration
+	stoponce    sync.Once
+	stopping    chan struct{}
+	drained     chan struct{}
+	stopped     chan struct{}
+	stoperr     error
+
+	started   time.Time
+	mu        sync.Mutex
+	hooks     []shutdownHook
+	report    *ShutdownReport
+	reportlog *slog.Logger
 }
 
+// every invalid option and conflicting combination is reported in one joined error
 func New(ctx context.Context, handler http.Handler, opts ...Option) (*Server, error) {
+	var errs []error
 	if handler == nil {
-		return nil, fmt.Errorf("undefined handler")
+		errs = append(errs, fmt.Errorf("undefined handler"))
 	}
 	var opt options
 	for _, option := range opts {
 		if err := option(&opt); err != nil {
-			return nil, err
+			errs = append(errs, err)
 		}
 	}
+	errs = append(errs, opt.validate()...)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 
 	host := ""
 	if opt.host != nil {
@@ -51,7 +215,11 @@ func New(ctx context.Context, handler http.Handler, opts ...Option) (*Server, er
 	if opt.port != nil {
 		port = *opt.port
 	}
-	_, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%s", host, port))
+	addr := net.JoinHostPort(host, port)
+	if len(opt.addresses) > 0 {
+		addr = opt.addresses[0]
+	}
+	_, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -71,24 +239,244 @@ func New(ctx context.Context, handler http.Handler, opts ...Option) (*Server, er
 	} else {
 		idletimeout = *opt.idletimeout
 	}
+	readheadertimeout := default_read_header_timeout
+	if opt.readheadertimeout != nil {
+		readheadertimeout = *opt.readheadertimeout
+	}
 	var maxheaderbytes int
 	if opt.maxheaderbytes == nil {
 		maxheaderbytes = http.DefaultMaxHeaderBytes
 	} else {
 		maxheaderbytes = *opt.maxheaderbytes
 	}
+	st := &stats{}
+	logger := slog.Default()
+	if opt.errorlog != nil {
+		logger = opt.errorlog
+	}
+	if opt.topology != nil {
+		attr := opt.topology.attr()
+		logger = logger.With(attr)
+		if opt.errorlog != nil {
+			opt.errorlog = logger
+		}
+		if opt.accesslog != nil {
+			opt.accesslog = opt.accesslog.With(attr)
+		}
+		if opt.shutdownreport != nil {
+			opt.shutdownreport = opt.shutdownreport.With(attr)
+		}
+	}
+	// fixed layers around the handler, innermost first
+	var inner []MiddlewareLayer
+	if opt.shadow != nil {
+		sc := &shadowCompare{
+			cfg:    *opt.shadow,
+			logger: logger,
+			stats:  st,
+			sem:    make(chan struct{}, shadow_max_concurrent),
+		}
+		handler = sc.wrap(handler)
+		inner = append(inner, newMiddlewareLayer("shadow_compare",
+			fmt.Sprint(opt.shadow.Sample, opt.shadow.Headers, opt.shadow.MaxBodyBytes, opt.shadow.Normalize != nil)))
+	}
+	// innermost, so pooled objects outlive a handler abandoned by the timeout
+	handler = requestScopeMiddleware(handler)
+	inner = append(inner, newMiddlewareLayer("request_scope", ""))
+	if opt.handlertimeout != nil {
+		handler = http.TimeoutHandler(handler, *opt.handlertimeout, opt.handlertimeoutmsg)
+		inner = append(inner, newMiddlewareLayer("handler_timeout", fmt.Sprint(*opt.handlertimeout, opt.handlertimeoutmsg)))
+	}
+	hijacks := newHijackRegistry()
+	handler = hijacks.dispatch(handler)
+	inner = append(inner, newMiddlewareLayer("hijack", ""))
+	mt := &maintenance{cfg: MaintenanceConfig{RetryAfter: default_maintenance_retry_after}}
+	if opt.maintenance != nil {
+		mt.cfg = *opt.maintenance
+	}
+	stopping := make(chan struct{})
+	var b chainBuilder
+	b.use("stats", "", st.middleware)
+	b.use("trusted_proxies", fmt.Sprint(opt.trustedproxies), opt.trustedproxies.middleware)
+	// ahead of every layer that can answer on its own, so rejections carry them too
+	if opt.securityheaders != nil {
+		b.use("security_headers", fmt.Sprint(opt.securityheaders), securityHeadersMiddleware(opt.securityheaders))
+	}
+	if opt.clientfingerprint != nil {
+		b.use("client_fingerprint", opt.clientfingerprint.rotation.String(), opt.clientfingerprint.middleware)
+	}
+	if opt.requestid {
+		b.use("request_id", "", requestIDMiddleware)
+	}
+	if opt.topologyheaders {
+		// the instance ID differs per instance, only whether it is sent counts
+		t := opt.topology
+		b.use("topology_headers", fmt.Sprint(t.Region, t.Zone, t.InstanceID != ""), t.middleware)
+	}
+	if opt.loadhints != nil {
+		lh := &loadHints{
+			capacity:    *opt.loadhints,
+			stats:       st,
+			maintenance: mt,
+			stopping:    stopping,
+		}
+		b.use("load_hints", fmt.Sprint(lh.capacity), lh.middleware)
+	}
+	if opt.events != nil {
+		b.use("events", fmt.Sprintf("%T", opt.events), eventsMiddleware(opt.events, opt.topology))
+	}
+	if al := newAccessLog(&opt); al != nil {
+		b.use("access_log", fmt.Sprint(al.logger != nil, al.common != nil, al.sample, opt.accesslogskip), al.middleware)
+	}
+	if opt.recovery {
+		rc := &recovery{
+			logger:   logger,
+			stats:    st,
+			response: defaultRecoveryResponse,
+		}
+		if opt.recoveryresponse != nil {
+			rc.response = opt.recoveryresponse
+		}
+		b.use("recovery", fmt.Sprint(opt.recoveryresponse != nil), rc.middleware)
+	}
+	b.use("maintenance", fmt.Sprint(mt.cfg.RetryAfter, mt.cfg.ExemptPaths, mt.cfg.ContentType, mt.cfg.Body), mt.middleware)
+	var memory *memoryMonitor
+	if opt.memorypressure != nil {
+		memory = &memoryMonitor{cfg: *opt.memorypressure, logger: logger, stats: st}
+		cfg := memory.cfg
+		b.use("memory_pressure", fmt.Sprint(cfg.Limit, cfg.GCThreshold, cfg.ShedThreshold, cfg.RejectThreshold, cfg.Interval, cfg.LowPriority != nil), memory.middleware)
+	}
+	if opt.ipfilter != nil {
+		b.use("ip_filter", fmt.Sprint(opt.ipfilter.allow, opt.ipfilter.deny), opt.ipfilter.middleware)
+	}
+	if opt.cors != nil {
+		b.use("cors", fmt.Sprintf("%+v", opt.cors.cfg), opt.cors.middleware)
+	}
+	if opt.ratelimit != nil {
+		rl := &rateLimiter{
+			rps:     *opt.ratelimit,
+			burst:   float64(opt.ratelimitburst),
+			key:     clientIP,
+			stats:   st,
+			buckets: make(map[string]*bucket),
+		}
+		if opt.ratelimitkey != nil {
+			rl.key = opt.ratelimitkey
+		}
+		b.use("rate_limit", fmt.Sprint(rl.rps, rl.burst, opt.ratelimitkey != nil), rl.middleware)
+	}
+	if len(opt.auth) > 0 {
+		var paths [][]string
+		for _, g := range opt.auth {
+			paths = append(paths, g.paths)
+		}
+		b.use("auth", fmt.Sprint(paths), authMiddleware(opt.auth, st))
+	}
+	var routebreaker *routeBreaker
+	if opt.routebreaker != nil {
+		routebreaker = newRouteBreaker(*opt.routebreaker, logger, st)
+		cfg := routebreaker.cfg
+		b.use("route_breaker", fmt.Sprint(cfg.Routes, cfg.ErrorRate, cfg.MinRequests, cfg.Window, cfg.OpenFor), routebreaker.middleware)
+	}
+	if opt.maxbodybytes != nil {
+		b.use("max_body_bytes", fmt.Sprint(*opt.maxbodybytes), maxBodyBytes(*opt.maxbodybytes))
+	}
+	if opt.compression != nil {
+		c := opt.compression
+		b.use("compression", fmt.Sprint(c.level, c.minsize, c.types), c.middleware)
+	}
+	if len(opt.responsesizelimits) > 0 {
+		rl := &responseSizeLimits{limits: opt.responsesizelimits, logger: logger}
+		b.use("response_size_limit", fmt.Sprint(opt.responsesizelimits), rl.middleware)
+	}
+	for i, mw := range opt.middleware {
+		b.use(opt.middlewarenames[i], "", mw)
+	}
+	handler = chain(handler, b.mws...)
+	layers := b.layers
+	for i := len(inner) - 1; i >= 0; i-- {
+		layers = append(layers, inner[i])
+	}
+	if opt.middlewaremanifest != nil {
+		if err := opt.middlewaremanifest.compare(layers); err != nil {
+			return nil, err
+		}
+	}
+	var errorlog *log.Logger
+	if opt.errorlog != nil {
+		errorlog = slog.NewLogLogger(opt.errorlog.Handler(), slog.LevelError)
+	}
+	var tlsconfig *tls.Config
+	if opt.tlscertfile != "" {
+		if tlsconfig, err = loadTLSConfig(opt.tlscertfile, opt.tlskeyfile); err != nil {
+			return nil, err
+		}
+	}
+	for _, fn := range opt.basecontext {
+		if ctx = fn(ctx); ctx == nil {
+			return nil, fmt.Errorf("base context function returned nil")
+		}
+	}
 	sctx, cancel := context.WithCancel(ctx)
 	s := &http.Server{
-		Addr:           fmt.Sprintf("%s:%s", host, port),
-		Handler:        handler,
-		WriteTimeout:   writetimeout,
-		ReadTimeout:    readtimeout,
-		IdleTimeout:    idletimeout,
-		MaxHeaderBytes: maxheaderbytes,
-		BaseContext:    func(_ net.Listener) context.Context { return sctx },
+		Addr:              addr,
+		Handler:           handler,
+		WriteTimeout:      writetimeout,
+		ReadTimeout:       readtimeout,
+		IdleTimeout:       idletimeout,
+		ReadHeaderTimeout: readheadertimeout,
+		MaxHeaderBytes:    maxheaderbytes,
+		BaseContext:       func(_ net.Listener) context.Context { return sctx },
+		ErrorLog:          errorlog,
+		TLSConfig:         tlsconfig,
+		ConnState:         opt.connstate,
+		ConnContext:       opt.conncontext,
+
+		DisableGeneralOptionsHandler: opt.disablegeneraloptionshandler,
+	}
+	if opt.keepalivesdisabled {
+		s.SetKeepAlivesEnabled(false)
 	}
 	s.RegisterOnShutdown(cancel)
-	return &Server{s}, nil
+	srv := &Server{Server: s, stats: st, ready: make(chan struct{})}
+	if opt.maxconnections != nil {
+		srv.connsem = make(chan struct{}, *opt.maxconnections)
+	}
+	if opt.tcpkeepalive != nil {
+		srv.tcpkeepalive = *opt.tcpkeepalive
+	}
+	srv.bandwidthlimit = opt.bandwidthlimit
+	srv.shards = opt.shards
+	srv.listenercontrol = opt.listenercontrol
+	srv.bindattempts = opt.bindattempts
+	srv.bindbackoff = opt.bindbackoff
+	srv.hijacks = hijacks
+	srv.maintenance = mt
+	srv.routebreaker = routebreaker
+	srv.events = opt.events
+	if opt.topology != nil {
+		srv.topology = *opt.topology
+	}
+	srv.shutdowntimeout = default_shutdown_timeout
+	if opt.shutdowntimeout != nil {
+		srv.shutdowntimeout = *opt.shutdowntimeout
+	}
+	srv.stopping = stopping
+	srv.drained = make(chan struct{})
+	srv.stopped = make(chan struct{})
+	srv.addrs = []string{addr}
+	if len(opt.addresses) > 0 {
+		srv.addrs = opt.addresses
+	}
+	srv.gctuning = opt.gctuning
+	srv.memory = memory
+	srv.proxyprotocol = opt.proxyprotocol
+	srv.reportlog = opt.shutdownreport
+	srv.draincoordinator = opt.draincoordinator
+	srv.chain = layers
+	srv.gracefulrestart = opt.gracefulrestart
+	srv.logger = logger
+	return srv, nil
 }
 
 func WithMaxHeaderBytes(bts int) Option {
@@ -112,6 +500,42 @@ func WithReadTimeout(timeout time.Duration) Option {
 	}
 }
 
+// bounds the time to read request headers, the main defense against slowloris
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(options *options) error {
+		options.readheadertimeout = &timeout
+		return nil
+	}
+}
+
+// every connection serves a single request, for proxies that mandate it
+func WithKeepAlivesDisabled() Option {
+	return func(options *options) error {
+		options.keepalivesdisabled = true
+		return nil
+	}
+}
+
+// "OPTIONS *" requests are passed to the handler instead of being answered
+// with 200 by net/http
+func WithDisableGeneralOptionsHandler() Option {
+	return func(options *options) error {
+		options.disablegeneraloptionshandler = true
+		return nil
+	}
+}
+
+// default for GracefulStop and StartWithAwaitStop(0)
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(options *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("shutdown timeout must be greater than zero")
+		}
+		options.shutdowntimeout = &timeout
+		return nil
+	}
+}
+
 func WithIdleTimeout(timeout time.Duration) Option {
 	return func(options *options) error {
 		options.idletimeout = &timeout
@@ -119,8 +543,83 @@ func WithIdleTimeout(timeout time.Duration) Option {
 	}
 }
 
+// internal server errors (TLS handshakes, handler panics) are logged at error level
+func WithErrorLog(logger *slog.Logger) Option {
+	return func(options *options) error {
+		if logger == nil {
+			return fmt.Errorf("undefined error logger")
+		}
+		options.errorlog = logger
+		return nil
+	}
+}
+
+// period between TCP keep-alive probes on accepted connections,
+// zero keeps the system default, negative disables keep-alive probes
+func WithTCPKeepAlive(period time.Duration) Option {
+	return func(options *options) error {
+		options.tcpkeepalive = &period
+		return nil
+	}
+}
+
+// called on every connection state change (new, active, idle, hijacked, closed)
+func WithConnState(fn func(net.Conn, http.ConnState)) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("undefined conn state callback")
+		}
+		options.connstate = fn
+		return nil
+	}
+}
+
+// fn derives the base context once in New, values it adds (loggers, DB
+// handles, feature flags) are available in every request's context
+func WithBaseContextValues(fn func(ctx context.Context) context.Context) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("undefined base context function")
+		}
+		options.basecontext = append(options.basecontext, fn)
+		return nil
+	}
+}
+
+// derives the context of every request on c, e.g. to attach connection IDs
+// or TLS details; runs in the accept loop, so it must not block
+// (with WithProxyProtocol, c.RemoteAddr waits for the PROXY header)
+func WithConnContext(fn func(ctx context.Context, c net.Conn) context.Context) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("undefined conn context")
+		}
+		options.conncontext = fn
+		return nil
+	}
+}
+
+// handlers running longer than timeout are answered with 503 and msg as the body;
+// wraps the handler in http.TimeoutHandler, which buffers the response and
+// does not support http.ResponseController (deadlines, Flush, Hijack)
+func WithHandlerTimeout(timeout time.Duration, msg string) Option {
+	return func(options *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("handler timeout must be greater than zero")
+		}
+		options.handlertimeout = &timeout
+		options.handlertimeoutmsg = msg
+		return nil
+	}
+}
+
+// IPv6 literals may be given with or without brackets
 func WithHost(host string) Option {
 	return func(options *options) error {
+		if options.addr != nil {
+			return fmt.Errorf("host conflicts with addr")
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
 		options.host = &host
 		return nil
 	}
@@ -129,20 +628,133 @@ func WithHost(host string) Option {
 // if port=0 listening to random available port
 func WithPort(port int) Option {
 	return func(options *options) error {
+		if options.addr != nil {
+			return fmt.Errorf("port conflicts with addr")
+		}
 		if port < 0 {
 			return fmt.Errorf("port cannot be less than zero")
 		}
+		if port > 65535 {
+			return fmt.Errorf("port cannot be greater than 65535")
+		}
 		p := fmt.Sprintf("%d", port)
 		options.port = &p
 		return nil
 	}
 }
 
-func (s *Server) StartWithAwaitStop(stoptimeout time.Duration) error {
-	go func() {
-		 s.ListenAndServe()
-	}()
+// alternative to WithHost and WithPort, e.g. "0.0.0.0:8080" or "[::1]:8080"
+func WithAddr(addr string) Option {
+	return func(options *options) error {
+		if options.addr == nil && (options.host != nil || options.port != nil) {
+			return fmt.Errorf("addr conflicts with host/port")
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		var p uint64
+		if port != "" {
+			if p, err = strconv.ParseUint(port, 10, 16); err != nil {
+				return fmt.Errorf("invalid port %q", port)
+			}
+		}
+		ps := fmt.Sprintf("%d", p)
+		options.addr = &addr
+		options.host = &host
+		options.port = &ps
+		return nil
+	}
+}
+
+// fills in the host and port the options before it left unset, so it has to
+// come last; does nothing next to WithAddresses
+func WithDefaultAddr(addr string) Option {
+	return func(options *options) error {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		if len(options.addresses) > 0 {
+			return nil
+		}
+		if options.host == nil {
+			options.host = &host
+		}
+		if options.port == nil {
+			options.port = &port
+		}
+		return nil
+	}
+}
+
+// serves the handler on every address, e.g. "0.0.0.0:8080", "[::]:8080";
+// replaces WithAddr/WithHost/WithPort
+func WithAddresses(addrs ...string) Option {
+	return func(options *options) error {
+		if len(addrs) == 0 {
+			return fmt.Errorf("no addresses")
+		}
+		for _, addr := range addrs {
+			if _, err := net.ResolveTCPAddr("tcp", addr); err != nil {
+				return err
+			}
+		}
+		options.addresses = append(options.addresses, addrs...)
+		return nil
+	}
+}
+
+// Ready is closed once the server is listening and awaiting a stop signal
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// the first bound address (useful with port=0), nil until Ready
+func (s *Server) ListenAddr() net.Addr {
+	if addrs := s.ListenAddrs(); len(addrs) > 0 {
+		return addrs[0]
+	}
+	return nil
+}
+
+// all bound addresses, nil until Ready
+func (s *Server) ListenAddrs() []net.Addr {
+	select {
+	case <-s.ready:
+	default:
+		return nil
+	}
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, ln := range s.listeners {
+		addrs[i] = ln.Addr()
+	}
+	return addrs
+}
 
+func (s *Server) wrapListener(ln net.Listener) net.Listener {
+	if s.bandwidthlimit != nil {
+		ln = &throttledListener{Listener: ln, limit: s.bandwidthlimit}
+	}
+	if s.proxyprotocol != nil {
+		ln = &proxyListener{Listener: ln, proto: s.proxyprotocol}
+	}
+	if s.memory != nil {
+		ln = &memoryListener{Listener: ln, monitor: s.memory}
+	}
+	if s.connsem != nil {
+		ln = newLimitListener(ln, s.connsem, s.stats)
+	}
+	return ln
+}
+
+// serves until a stop signal or GracefulStop, then shuts down gracefully
+// within stoptimeout (the WithShutdownTimeout value when zero)
+func (s *Server) StartWithAwaitStop(stoptimeout time.Duration) error {
+	if stoptimeout <= 0 {
+		stoptimeout = s.shutdowntimeout
+	}
+	s.stoptimeout = stoptimeout
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig,
 		os.Interrupt,
@@ -152,13 +764,74 @@ func (s *Server) StartWithAwaitStop(stoptimeout time.Duration) error {
 		syscall.SIGTERM,
 		syscall.SIGHUP,
 	)
-	<-sig
+	if s.gracefulrestart {
+		signal.Notify(sig, restart_signal)
+	}
+	defer signal.Stop(sig)
 
-	ctx, cancel := context.WithTimeout(s.BaseContext(nil), stoptimeout)
-	defer cancel()
-	s.SetKeepAlivesEnabled(false)
-	
-	return s.Shutdown(ctx)
-}
+	if s.gctuning != nil {
+		s.ballast = s.gctuning.apply()
+	}
 
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.rawlisteners = lns
+	s.stats.accepts = make([]atomic.Uint64, len(lns))
+	// Serve fills in TLSConfig for HTTP/2, decide before the first one runs
+	servetls := s.TLSConfig != nil
+	serve := make(chan error, len(lns))
+	for i, ln := range lns {
+		ln = &countListener{Listener: ln, accepts: &s.stats.accepts[i]}
+		ln = s.wrapListener(ln)
+		s.listeners = append(s.listeners, ln)
+		go func(ln net.Listener) {
+			if servetls {
+				serve <- s.ServeTLS(ln, "", "")
+				return
+			}
+			serve <- s.Serve(ln)
+		}(ln)
+	}
+	s.started = time.Now()
+	close(s.ready)
+	s.publish(EventServerStarted)
+	if s.memory != nil {
+		go s.monitorMemory(s.stopped)
+	}
+	if s.gracefulrestart {
+		if err := notifyParent(); err != nil {
+			s.logger.Error("graceful restart, notify parent", "error", err)
+		}
+	}
 
+	for {
+		select {
+		case sg := <-sig:
+			if s.gracefulrestart && sg == restart_signal {
+				if err := s.upgrade(s.rawlisteners); err != nil {
+					s.logger.Error("graceful restart", "error", err)
+				}
+				continue
+			}
+			return s.stop(stoptimeout)
+		case <-s.stopping:
+			<-s.stopped
+			return s.stoperr
+		case err := <-serve:
+			if errors.Is(err, http.ErrServerClosed) {
+				select {
+				case <-s.stopping:
+					<-s.stopped
+					return s.stoperr
+				default:
+					return nil
+				}
+			}
+			// one failed listener stops the others
+			s.Close()
+			return err
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package servertest
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	server "github.com/quietpleasure/server-http"
+)
+
+// CheckResponseController serves a request through a server built with opts
+// (e.g. server.WithMiddleware with custom middleware) and fails tb for every
+// http.ResponseController method the handler cannot reach through the
+// wrapped http.ResponseWriter: SetReadDeadline, SetWriteDeadline,
+// EnableFullDuplex and Flush. Wrappers pass them on by implementing
+// Unwrap() http.ResponseWriter. Options answering the request before the
+// handler, e.g. authentication, fail the check.
+func CheckResponseController(tb testing.TB, opts ...server.Option) {
+	tb.Helper()
+	done := make(chan []string, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var failures []string
+		rc := http.NewResponseController(w)
+		deadline := time.Now().Add(time.Minute)
+		for _, c := range []struct {
+			name string
+			fn   func() error
+		}{
+			{"SetReadDeadline", func() error { return rc.SetReadDeadline(deadline) }},
+			{"SetWriteDeadline", func() error { return rc.SetWriteDeadline(deadline) }},
+			{"EnableFullDuplex", rc.EnableFullDuplex},
+			{"Flush", rc.Flush},
+		} {
+			if err := c.fn(); err != nil {
+				failures = append(failures, c.name+": "+err.Error())
+			}
+		}
+		io.WriteString(w, "ok")
+		done <- failures
+	})
+	ts := NewTestServer(tb, handler, opts...)
+	resp, err := ts.Client.Get(ts.URL + "/")
+	if err != nil {
+		tb.Fatalf("response controller check: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		tb.Fatalf("response controller check: request did not reach the handler: %s", resp.Status)
+	}
+	select {
+	case failures := <-done:
+		for _, f := range failures {
+			tb.Errorf("response controller %s", f)
+		}
+	case <-time.After(default_wait):
+		tb.Fatalf("response controller check: handler not done after %s", default_wait)
+	}
+}
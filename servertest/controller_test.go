@@ -0,0 +1,92 @@
+package servertest_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	server "github.com/quietpleasure/server-http"
+	"github.com/quietpleasure/server-http/servertest"
+)
+
+func TestCheckResponseControllerBuiltins(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for name, opt := range map[string]server.Option{
+		"compression":         server.WithCompression(5, 1, nil),
+		"access log":          server.WithAccessLog(logger),
+		"recovery":            server.WithRecovery(),
+		"response size limit": server.WithResponseSizeLimit("/", 1<<20),
+		"shadow compare": server.WithShadowCompare(server.ShadowConfig{
+			Handler: http.NotFoundHandler(),
+			Sample:  1,
+		}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			servertest.CheckResponseController(t, opt, server.WithErrorLog(logger))
+		})
+	}
+}
+
+// records failures instead of failing the test
+type recordingTB struct {
+	testing.TB
+	mu       sync.Mutex
+	failures []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Fatal(args ...any) {
+	r.Errorf("%s", fmt.Sprint(args...))
+	runtime.Goexit()
+}
+
+func (r *recordingTB) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func TestCheckResponseControllerHandlerNotReached(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		servertest.CheckResponseController(tb, server.WithBasicAuth("test", func(user, pass string) bool { return false }))
+	}()
+	<-done
+	if len(tb.failures) != 1 || !strings.Contains(tb.failures[0], "did not reach the handler") {
+		t.Fatalf("failures = %q", tb.failures)
+	}
+}
+
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestCheckResponseControllerReportsMissingUnwrap(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		servertest.CheckResponseController(tb, server.WithMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(plainWriter{w}, r)
+			})
+		}))
+	}()
+	<-done
+	if len(tb.failures) != 4 {
+		t.Fatalf("failures = %q", tb.failures)
+	}
+}
@@ -0,0 +1,53 @@
+package servertest
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"testing"
+	"time"
+
+	server "github.com/quietpleasure/server-http"
+)
+
+const default_stop_timeout = 5 * time.Second
+
+// TestServer is a server listening on a random loopback port.
+type TestServer struct {
+	*Running
+	// base URL, e.g. http://127.0.0.1:41234
+	URL    string
+	Client *http.Client
+}
+
+// NewTestServer starts handler on 127.0.0.1 with a random port, unless opts
+// set the host, port or addresses, and stops it gracefully on test cleanup.
+func NewTestServer(tb testing.TB, handler http.Handler, opts ...server.Option) *TestServer {
+	tb.Helper()
+	opts = append(opts[:len(opts):len(opts)], server.WithDefaultAddr("127.0.0.1:0"))
+	s, err := server.New(context.Background(), handler, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	scheme := "http"
+	// checked before serving, which fills in TLSConfig for HTTP/2
+	if s.TLSConfig != nil {
+		scheme = "https"
+		// test certificates are rarely signed by a trusted CA
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	r := Start(tb, s, default_stop_timeout)
+	ts := &TestServer{
+		Running: r,
+		URL:     scheme + "://" + r.Addr,
+		Client:  &http.Client{Transport: transport, Timeout: default_stop_timeout},
+	}
+	tb.Cleanup(func() {
+		transport.CloseIdleConnections()
+		if err := s.GracefulStop(); err != nil {
+			tb.Errorf("stop test server: %v", err)
+		}
+	})
+	return ts
+}
@@ -0,0 +1,160 @@
+// Package servertest provides helpers for testing applications built on server.
+package servertest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	server "github.com/quietpleasure/server-http"
+)
+
+const default_wait = 5 * time.Second
+
+// Running is a server started with StartWithAwaitStop in the background.
+type Running struct {
+	Server *server.Server
+	Addr   string
+	done   chan error
+}
+
+// Start runs s.StartWithAwaitStop(stoptimeout) and waits until it is listening.
+// The server is closed on test cleanup if it is still running.
+func Start(tb testing.TB, s *server.Server, stoptimeout time.Duration) *Running {
+	tb.Helper()
+	r := &Running{Server: s, done: make(chan error, 1)}
+	go func() {
+		r.done <- s.StartWithAwaitStop(stoptimeout)
+	}()
+	select {
+	case <-s.Ready():
+	case err := <-r.done:
+		tb.Fatalf("server stopped before ready: %v", err)
+	case <-time.After(default_wait):
+		tb.Fatalf("server not ready after %s", default_wait)
+	}
+	r.Addr = s.ListenAddr().String()
+	tb.Cleanup(func() { s.Close() })
+	return r
+}
+
+// Signal delivers sig to the current process as an orchestrator would on stop.
+func (r *Running) Signal(tb testing.TB, sig os.Signal) {
+	tb.Helper()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := p.Signal(sig); err != nil {
+		tb.Fatalf("send %v: %v", sig, err)
+	}
+}
+
+// Wait returns the result of StartWithAwaitStop, failing the test if it
+// does not return within timeout.
+func (r *Running) Wait(tb testing.TB, timeout time.Duration) error {
+	tb.Helper()
+	select {
+	case err := <-r.done:
+		return err
+	case <-time.After(timeout):
+		tb.Fatalf("server did not stop within %s", timeout)
+		return nil
+	}
+}
+
+// AssertDrained waits for a clean stop: every in-flight request completed
+// before the shutdown deadline.
+func (r *Running) AssertDrained(tb testing.TB, timeout time.Duration) {
+	tb.Helper()
+	if err := r.Wait(tb, timeout); err != nil {
+		tb.Fatalf("shutdown not clean: %v", err)
+	}
+}
+
+// AssertDeadlineExceeded waits for a stop cut off by the shutdown deadline.
+func (r *Running) AssertDeadlineExceeded(tb testing.TB, timeout time.Duration) {
+	tb.Helper()
+	err := r.Wait(tb, timeout)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		tb.Fatalf("expected shutdown deadline to be exceeded, got %v", err)
+	}
+}
+
+// AssertRefusing polls until new connections to the server are refused.
+func (r *Running) AssertRefusing(tb testing.TB, timeout time.Duration) {
+	tb.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", r.Addr, 100*time.Millisecond)
+		if err != nil {
+			return
+		}
+		conn.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	tb.Fatalf("server still accepts connections after %s", timeout)
+}
+
+// Gate is a handler whose requests block until Release is called,
+// simulating slow in-flight work during shutdown. Release it before the
+// test ends.
+type Gate struct {
+	started   chan struct{}
+	release   chan struct{}
+	once      sync.Once
+	inflight  atomic.Int64
+	completed atomic.Int64
+}
+
+func NewGate() *Gate {
+	return &Gate{
+		started: make(chan struct{}, 1024),
+		release: make(chan struct{}),
+	}
+}
+
+func (g *Gate) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	g.inflight.Add(1)
+	defer g.inflight.Add(-1)
+	select {
+	case g.started <- struct{}{}:
+	default:
+	}
+	// the request context is canceled when shutdown starts, slow work
+	// that ignores it is what drain has to wait for
+	<-g.release
+	g.completed.Add(1)
+	w.WriteHeader(http.StatusOK)
+}
+
+// WaitStarted blocks until n requests have entered the handler.
+func (g *Gate) WaitStarted(tb testing.TB, n int) {
+	tb.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-g.started:
+		case <-time.After(default_wait):
+			tb.Fatalf("%d of %d requests started", i, n)
+		}
+	}
+}
+
+// Release lets every blocked and future request complete.
+func (g *Gate) Release() {
+	g.once.Do(func() { close(g.release) })
+}
+
+func (g *Gate) InFlight() int {
+	return int(g.inflight.Load())
+}
+
+func (g *Gate) Completed() int {
+	return int(g.completed.Load())
+}
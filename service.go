@@ -0,0 +1,11 @@
+//go:build !windows
+
+package server
+
+import "time"
+
+// runs as a Windows service when started by the service control manager;
+// elsewhere it is StartWithAwaitStop
+func (s *Server) RunService(name string, stoptimeout time.Duration) error {
+	return s.StartWithAwaitStop(stoptimeout)
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	service_win32_own_process = 0x10
+
+	service_stopped       = 1
+	service_start_pending = 2
+	service_stop_pending  = 3
+	service_running       = 4
+
+	service_accept_stop     = 0x1
+	service_accept_shutdown = 0x4
+
+	service_control_stop        = 1
+	service_control_interrogate = 4
+	service_control_shutdown    = 5
+
+	error_call_not_implemented              = syscall.Errno(120)
+	error_failed_service_controller_connect = syscall.Errno(1063)
+)
+
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+type windowsService struct {
+	server  *Server
+	name    *uint16
+	timeout time.Duration
+
+	mu     sync.Mutex
+	handle uintptr
+	err    error
+}
+
+// runs as a Windows service when started by the service control manager,
+// Stop and Shutdown requests go through GracefulStop; when started from a
+// console it is StartWithAwaitStop
+func (s *Server) RunService(name string, stoptimeout time.Duration) error {
+	namep, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	svc := &windowsService{server: s, name: namep, timeout: stoptimeout}
+	table := []serviceTableEntry{
+		{name: namep, proc: syscall.NewCallback(svc.main)},
+		{},
+	}
+	// blocks until the service has stopped
+	r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))
+	if r == 0 {
+		if err == error_failed_service_controller_connect {
+			return s.StartWithAwaitStop(stoptimeout)
+		}
+		return err
+	}
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return svc.err
+}
+
+func (svc *windowsService) setStatus(state, accepted, exitcode uint32) {
+	status := serviceStatus{
+		serviceType:      service_win32_own_process,
+		currentState:     state,
+		controlsAccepted: accepted,
+		win32ExitCode:    exitcode,
+	}
+	if state == service_start_pending || state == service_stop_pending {
+		status.waitHint = uint32(svc.timeout.Milliseconds()) + 1000
+	}
+	procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(&status)))
+}
+
+// ServiceMain, called by the service control manager on its own thread
+func (svc *windowsService) main(argc uint32, argv **uint16) uintptr {
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(
+		uintptr(unsafe.Pointer(svc.name)),
+		syscall.NewCallback(svc.control),
+		0,
+	)
+	if h == 0 {
+		svc.mu.Lock()
+		svc.err = err
+		svc.mu.Unlock()
+		return 0
+	}
+	svc.handle = h
+	svc.setStatus(service_start_pending, 0, 0)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.server.StartWithAwaitStop(svc.timeout)
+	}()
+	select {
+	case <-svc.server.Ready():
+		svc.setStatus(service_running, service_accept_stop|service_accept_shutdown, 0)
+		err = <-done
+	case err = <-done:
+	}
+
+	var exitcode uint32
+	if err != nil {
+		exitcode = 1
+	}
+	svc.mu.Lock()
+	svc.err = err
+	svc.mu.Unlock()
+	svc.setStatus(service_stopped, 0, exitcode)
+	return 0
+}
+
+// HandlerEx
+func (svc *windowsService) control(ctrl, eventtype uint32, eventdata, context uintptr) uintptr {
+	switch ctrl {
+	case service_control_stop, service_control_shutdown:
+		svc.setStatus(service_stop_pending, 0, 0)
+		go svc.server.GracefulStop()
+		return 0
+	case service_control_interrogate:
+		return 0
+	}
+	return uintptr(error_call_not_implemented)
+}
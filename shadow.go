@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+)
+
+const (
+	default_shadow_max_body_bytes = 1 << 20
+	shadow_max_concurrent         = 64
+)
+
+type ShadowConfig struct {
+	// the new implementation, its responses are discarded
+	Handler http.Handler
+	// fraction of GET and HEAD requests also served by Handler, other
+	// methods are never shadowed as they may have side effects
+	Sample float64
+	// compared besides status and body, Content-Type by default
+	Headers []string
+	// applied to both bodies before comparing, e.g. to blank out timestamps
+	Normalize func(body []byte) []byte
+	// bodies captured for comparison, longer ones are compared by status
+	// and headers only; 1 MiB by default
+	MaxBodyBytes int64
+}
+
+type shadowCompare struct {
+	cfg    ShadowConfig
+	logger *slog.Logger
+	stats  *stats
+	// shadow requests running after their primary response, more are skipped
+	sem chan struct{}
+}
+
+// captures the status, headers and body of a response, the body up to max bytes
+type shadowRecorder struct {
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (rec *shadowRecorder) capture(b []byte) {
+	if rec.truncated {
+		return
+	}
+	if int64(rec.body.Len()+len(b)) > rec.max {
+		rec.truncated = true
+		return
+	}
+	rec.body.Write(b)
+}
+
+func (rec *shadowRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *shadowRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+}
+
+func (rec *shadowRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.capture(b)
+	return len(b), nil
+}
+
+// passes the primary response through while recording it
+type teeResponseWriter struct {
+	*responseWriter
+	rec *shadowRecorder
+}
+
+func (w *teeResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.responseWriter.Write(b)
+	w.rec.capture(b[:n])
+	return n, err
+}
+
+// through Write, so the body is recorded
+func (w *teeResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(writerOnly{w}, src)
+}
+
+func (sc *shadowCompare) wrap(primary http.Handler) http.Handler {
+	shadow := requestScopeMiddleware(sc.cfg.Handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || rand.Float64() >= sc.cfg.Sample {
+			primary.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case sc.sem <- struct{}{}:
+		default:
+			primary.ServeHTTP(w, r)
+			return
+		}
+		tee := &teeResponseWriter{responseWriter: newResponseWriter(w), rec: &shadowRecorder{max: sc.cfg.MaxBodyBytes}}
+		served := false
+		defer func() {
+			// the primary panicked, there is nothing to compare against
+			if !served {
+				<-sc.sem
+			}
+		}()
+		primary.ServeHTTP(expose(tee), r)
+		served = true
+		want := tee.rec
+		want.status = tee.Status()
+		want.header = w.Header().Clone()
+
+		// the shadow runs after the primary response, adding no latency
+		sr := r.Clone(context.WithoutCancel(r.Context()))
+		sr.Body = http.NoBody
+		go func() {
+			defer func() { <-sc.sem }()
+			got := &shadowRecorder{header: make(http.Header), max: sc.cfg.MaxBodyBytes}
+			defer func() {
+				if err := recover(); err != nil {
+					sc.stats.shadowmismatches.Add(1)
+					sc.logger.Warn("shadow handler panic",
+						slog.Any("error", err),
+						slog.String("method", sr.Method),
+						slog.String("path", sr.URL.Path),
+						slog.String("request_id", RequestIDFromContext(sr.Context())),
+					)
+				}
+			}()
+			shadow.ServeHTTP(got, sr)
+			if got.status == 0 {
+				got.status = http.StatusOK
+			}
+			sc.compare(sr, want, got)
+		}()
+	})
+}
+
+func (sc *shadowCompare) compare(r *http.Request, want, got *shadowRecorder) {
+	sc.stats.shadowcompared.Add(1)
+	var diffs []string
+	if want.status != got.status {
+		diffs = append(diffs, "status")
+	}
+	for _, h := range sc.cfg.Headers {
+		if want.header.Get(h) != got.header.Get(h) {
+			diffs = append(diffs, "header "+h)
+		}
+	}
+	if !want.truncated && !got.truncated {
+		wantbody, gotbody := want.body.Bytes(), got.body.Bytes()
+		if sc.cfg.Normalize != nil {
+			wantbody, gotbody = sc.cfg.Normalize(wantbody), sc.cfg.Normalize(gotbody)
+		}
+		if !bytes.Equal(wantbody, gotbody) {
+			diffs = append(diffs, "body")
+		}
+	}
+	if len(diffs) == 0 {
+		return
+	}
+	sc.stats.shadowmismatches.Add(1)
+	sc.logger.Warn("shadow mismatch",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("request_id", RequestIDFromContext(r.Context())),
+		slog.Any("diff", diffs),
+		slog.Int("status", want.status),
+		slog.Int("shadow_status", got.status),
+	)
+}
+
+// serves sampled requests by cfg.Handler as well and compares the responses
+// with the ones of the server handler, mismatches are logged and counted in
+// Stats; meant for verifying a refactored handler on live traffic
+func WithShadowCompare(cfg ShadowConfig) Option {
+	return func(options *options) error {
+		if cfg.Handler == nil {
+			return fmt.Errorf("undefined shadow handler")
+		}
+		if cfg.Sample <= 0 || cfg.Sample > 1 {
+			return fmt.Errorf("shadow sample must be in (0, 1]")
+		}
+		if cfg.MaxBodyBytes < 0 {
+			return fmt.Errorf("shadow max body bytes cannot be less than zero")
+		}
+		if cfg.MaxBodyBytes == 0 {
+			cfg.MaxBodyBytes = default_shadow_max_body_bytes
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = []string{"Content-Type"}
+		}
+		options.shadow = &cfg
+		return nil
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type HookReport struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+type ShutdownReport struct {
+	Uptime        time.Duration
+	Stats         Stats
+	DrainDuration time.Duration
+	// requests in flight when draining started, of those Completed finished
+	// before the deadline and CutOff were still running when connections
+	// were closed forcibly
+	InFlight  int
+	Completed int
+	CutOff    int
+	Hooks     []HookReport
+	// connections still open at the deadline were closed forcibly
+	ForceClosed bool
+}
+
+// fn runs after connections are drained, in registration order, with its own
+// deadline of the stop timeout
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// nil until the server has stopped
+func (s *Server) ShutdownReport() *ShutdownReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.report
+}
+
+// closed once draining has finished, either because every connection went
+// idle or because the stop timeout closed the rest
+func (s *Server) Drained() <-chan struct{} {
+	return s.drained
+}
+
+// shuts the server down like a stop signal would and waits for it to finish,
+// using the StartWithAwaitStop timeout when running, WithShutdownTimeout otherwise
+func (s *Server) GracefulStop() error {
+	timeout := s.shutdowntimeout
+	select {
+	case <-s.ready:
+		timeout = s.stoptimeout
+	default:
+	}
+	return s.stop(timeout)
+}
+
+// runs the graceful shutdown once, later callers get the same result
+func (s *Server) stop(timeout time.Duration) error {
+	s.stoponce.Do(func() {
+		close(s.stopping)
+		s.publish(EventServerDraining)
+		s.stoperr = s.shutdown(timeout)
+		s.publish(EventServerStopped)
+		close(s.stopped)
+	})
+	<-s.stopped
+	return s.stoperr
+}
+
+func (s *Server) shutdown(stoptimeout time.Duration) error {
+	// the base context is canceled on shutdown, the deadline must outlive it
+	base := context.WithoutCancel(s.BaseContext(nil))
+	var errs []error
+	report := &ShutdownReport{}
+	if !s.started.IsZero() {
+		report.Uptime = time.Since(s.started)
+	}
+	if err := s.coordinateDrain(base, "started"); err != nil {
+		errs = append(errs, err)
+	}
+
+	ctx, cancel := context.WithTimeout(base, stoptimeout)
+	defer cancel()
+	s.SetKeepAlivesEnabled(false)
+	drain := time.Now()
+	report.InFlight = s.InFlight()
+	err := s.Shutdown(ctx)
+	if err == nil {
+		err = s.hijacks.drain(ctx)
+	}
+	report.DrainDuration = time.Since(drain)
+	if errors.Is(err, context.DeadlineExceeded) {
+		report.CutOff = min(s.InFlight(), report.InFlight)
+		s.Close()
+		s.hijacks.drain(ctx)
+		report.ForceClosed = true
+	}
+	report.Completed = report.InFlight - report.CutOff
+	close(s.drained)
+	errs = append(errs, err)
+	if err := s.coordinateDrain(base, "completed"); err != nil {
+		errs = append(errs, err)
+	}
+
+	s.mu.Lock()
+	hooks := append([]shutdownHook(nil), s.hooks...)
+	s.mu.Unlock()
+	for _, h := range hooks {
+		hctx, hcancel := context.WithTimeout(base, stoptimeout)
+		start := time.Now()
+		herr := h.fn(hctx)
+		hcancel()
+		report.Hooks = append(report.Hooks, HookReport{Name: h.name, Duration: time.Since(start), Err: herr})
+		if herr != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", h.name, herr))
+		}
+	}
+	report.Stats = s.Stats()
+
+	s.mu.Lock()
+	s.report = report
+	s.mu.Unlock()
+	if s.reportlog != nil {
+		s.reportlog.LogAttrs(base, slog.LevelInfo, "shutdown report", report.attrs()...)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *ShutdownReport) attrs() []slog.Attr {
+	hooks := make([]any, 0, len(r.Hooks))
+	for _, h := range r.Hooks {
+		attrs := []any{slog.Duration("duration", h.Duration)}
+		if h.Err != nil {
+			attrs = append(attrs, slog.String("error", h.Err.Error()))
+		}
+		hooks = append(hooks, slog.Group(h.Name, attrs...))
+	}
+	return []slog.Attr{
+		slog.Duration("uptime", r.Uptime),
+		slog.Uint64("requests", r.Stats.Requests),
+		slog.Group("responses",
+			slog.Uint64("1xx", r.Stats.Responses[1]),
+			slog.Uint64("2xx", r.Stats.Responses[2]),
+			slog.Uint64("3xx", r.Stats.Responses[3]),
+			slog.Uint64("4xx", r.Stats.Responses[4]),
+			slog.Uint64("5xx", r.Stats.Responses[5]),
+		),
+		slog.Uint64("panics", r.Stats.Panics),
+		slog.Duration("drain", r.DrainDuration),
+		slog.Int("in_flight", r.InFlight),
+		slog.Int("completed", r.Completed),
+		slog.Int("cut_off", r.CutOff),
+		slog.Group("hooks", hooks...),
+		slog.Bool("force_closed", r.ForceClosed),
+	}
+}
+
+// logs a single structured ShutdownReport when the server stops
+func WithShutdownReport(logger *slog.Logger) Option {
+	return func(options *options) error {
+		if logger == nil {
+			return fmt.Errorf("undefined shutdown report logger")
+		}
+		options.shutdownreport = logger
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const so_attach_bpf = 50
+
+// attaches a classic BPF program to the listening sockets, packets it
+// rejects are dropped by the kernel before reaching the accept queue
+func WithSocketFilter(filter []syscall.SockFilter) Option {
+	return func(options *options) error {
+		if len(filter) == 0 {
+			return fmt.Errorf("empty socket filter")
+		}
+		filter := append([]syscall.SockFilter(nil), filter...)
+		return WithListenerControl(func(_, _ string, c syscall.RawConn) error {
+			var serr error
+			err := c.Control(func(fd uintptr) {
+				serr = syscall.AttachLsf(int(fd), filter)
+			})
+			if err != nil {
+				return err
+			}
+			return serr
+		})(options)
+	}
+}
+
+// attaches an already loaded eBPF socket filter program (SO_ATTACH_BPF)
+// to the listening sockets
+func WithBPFProgram(progfd int) Option {
+	return func(options *options) error {
+		if progfd < 0 {
+			return fmt.Errorf("invalid bpf program descriptor %d", progfd)
+		}
+		return WithListenerControl(func(_, _ string, c syscall.RawConn) error {
+			var serr error
+			err := c.Control(func(fd uintptr) {
+				serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, so_attach_bpf, progfd)
+			})
+			if err != nil {
+				return err
+			}
+			return serr
+		})(options)
+	}
+}
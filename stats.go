@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+type Stats struct {
+	Requests uint64
+	// responses by status class, index 1 is 1xx ... index 5 is 5xx
+	Responses [6]uint64
+	Panics    uint64
+	// accepts that had to wait because of WithMaxConnections
+	ConnLimitHits uint64
+	// requests rejected by WithRateLimit
+	RateLimited uint64
+	// requests rejected by WithBasicAuth or WithAPIKey
+	AuthFailures uint64
+	// requests rejected by WithRouteBreaker on an open route
+	RouteBreakerRejected uint64
+	// requests shed and connections closed by WithMemoryPressure
+	MemoryShed     uint64
+	MemoryRejected uint64
+	// responses compared by WithShadowCompare and those that differed
+	ShadowCompared   uint64
+	ShadowMismatches uint64
+	// accepted connections per listener (address and shard), in ListenAddrs order
+	Accepts []uint64
+}
+
+type stats struct {
+	requests      atomic.Uint64
+	responses     [6]atomic.Uint64
+	panics        atomic.Uint64
+	connlimithits atomic.Uint64
+	ratelimited   atomic.Uint64
+	authfailures  atomic.Uint64
+	inflight      atomic.Int64
+
+	routebreakerrejected atomic.Uint64
+
+	memoryshed     atomic.Uint64
+	memoryrejected atomic.Uint64
+
+	shadowcompared   atomic.Uint64
+	shadowmismatches atomic.Uint64
+	// allocated once the listeners are bound
+	accepts []atomic.Uint64
+}
+
+func (st *stats) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st.requests.Add(1)
+		st.inflight.Add(1)
+		rw := newResponseWriter(w)
+		defer func() {
+			st.inflight.Add(-1)
+			if err := recover(); err != nil {
+				// without recovery the connection is dropped, count it as a
+				// failed request; ErrAbortHandler is a deliberate abort or a
+				// panic recovery has already counted
+				st.responses[5].Add(1)
+				if err != http.ErrAbortHandler {
+					st.panics.Add(1)
+				}
+				panic(err)
+			}
+			if class := rw.Status() / 100; class > 0 && class < len(st.responses) {
+				st.responses[class].Add(1)
+			}
+		}()
+		next.ServeHTTP(expose(rw), r)
+	})
+}
+
+func (s *Server) Stats() Stats {
+	st := Stats{
+		Requests:      s.stats.requests.Load(),
+		Panics:        s.stats.panics.Load(),
+		ConnLimitHits: s.stats.connlimithits.Load(),
+		RateLimited:   s.stats.ratelimited.Load(),
+		AuthFailures:  s.stats.authfailures.Load(),
+
+		RouteBreakerRejected: s.stats.routebreakerrejected.Load(),
+
+		MemoryShed:     s.stats.memoryshed.Load(),
+		MemoryRejected: s.stats.memoryrejected.Load(),
+
+		ShadowCompared:   s.stats.shadowcompared.Load(),
+		ShadowMismatches: s.stats.shadowmismatches.Load(),
+	}
+	for i := range st.Responses {
+		st.Responses[i] = s.stats.responses[i].Load()
+	}
+	select {
+	case <-s.ready:
+		st.Accepts = make([]uint64, len(s.stats.accepts))
+		for i := range s.stats.accepts {
+			st.Accepts[i] = s.stats.accepts[i].Load()
+		}
+	default:
+	}
+	return st
+}
+
+// requests currently being handled
+func (s *Server) InFlight() int {
+	return int(s.stats.inflight.Load())
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+func loadTLSConfig(certfile, keyfile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certfile, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
+// serves HTTPS with the PEM encoded certificate and key files
+func WithTLS(certFile, keyFile string) Option {
+	return func(options *options) error {
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("tls requires both certificate and key files")
+		}
+		options.tlscertfile = certFile
+		options.tlskeyfile = keyFile
+		return nil
+	}
+}
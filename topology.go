@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// where the server runs, attached to its logs, events and optionally response
+// headers; integrations for metrics and discovery read it from Server.Topology
+type Topology struct {
+	Region     string
+	Zone       string
+	InstanceID string
+}
+
+func (t Topology) attr() slog.Attr {
+	var attrs []any
+	if t.Region != "" {
+		attrs = append(attrs, slog.String("region", t.Region))
+	}
+	if t.Zone != "" {
+		attrs = append(attrs, slog.String("zone", t.Zone))
+	}
+	if t.InstanceID != "" {
+		attrs = append(attrs, slog.String("instance_id", t.InstanceID))
+	}
+	return slog.Group("topology", attrs...)
+}
+
+func (t Topology) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		if t.Region != "" {
+			h.Set("X-Region", t.Region)
+		}
+		if t.Zone != "" {
+			h.Set("X-Zone", t.Zone)
+		}
+		if t.InstanceID != "" {
+			h.Set("X-Instance-ID", t.InstanceID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// empty values are left out
+func WithTopology(region, zone, instanceID string) Option {
+	return func(options *options) error {
+		if region == "" && zone == "" && instanceID == "" {
+			return fmt.Errorf("undefined topology")
+		}
+		options.topology = &Topology{Region: region, Zone: zone, InstanceID: instanceID}
+		return nil
+	}
+}
+
+// sets X-Region, X-Zone and X-Instance-ID on every response
+func WithTopologyHeaders() Option {
+	return func(options *options) error {
+		options.topologyheaders = true
+		return nil
+	}
+}
+
+// zero when WithTopology is not set
+func (s *Server) Topology() Topology {
+	return s.topology
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// checks single values left unchecked by the options and their combinations
+func (opt *options) validate() []error {
+	var errs []error
+	for _, t := range []struct {
+		name    string
+		timeout *time.Duration
+	}{
+		{"write timeout", opt.writetimeout},
+		{"read timeout", opt.readtimeout},
+		{"read header timeout", opt.readheadertimeout},
+		{"idle timeout", opt.idletimeout},
+	} {
+		if t.timeout != nil && *t.timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s cannot be less than zero", t.name))
+		}
+	}
+	// checked here rather than in the options so their order does not matter
+	if len(opt.addresses) > 0 && (opt.addr != nil || opt.host != nil || opt.port != nil) {
+		errs = append(errs, fmt.Errorf("addresses conflict with addr/host/port"))
+	}
+	if opt.maxheaderbytes != nil && *opt.maxheaderbytes < 0 {
+		errs = append(errs, fmt.Errorf("max header bytes cannot be less than zero"))
+	}
+
+	writetimeout := default_write_timeout
+	if opt.writetimeout != nil {
+		writetimeout = *opt.writetimeout
+	}
+	if opt.handlertimeout != nil && writetimeout > 0 && *opt.handlertimeout >= writetimeout {
+		errs = append(errs, fmt.Errorf("handler timeout %s must be less than write timeout %s, or the 503 cannot be written", *opt.handlertimeout, writetimeout))
+	}
+	readtimeout := default_read_timeout
+	if opt.readtimeout != nil {
+		readtimeout = *opt.readtimeout
+	}
+	if opt.readheadertimeout != nil && readtimeout > 0 && *opt.readheadertimeout > readtimeout {
+		errs = append(errs, fmt.Errorf("read header timeout %s exceeds read timeout %s", *opt.readheadertimeout, readtimeout))
+	}
+	if (opt.accesslogsample != nil || len(opt.accesslogskip) > 0) && opt.accesslog == nil && opt.commonlog == nil {
+		errs = append(errs, fmt.Errorf("access log sampling and skip paths require WithAccessLog or WithCommonLog"))
+	}
+	if opt.ratelimitkey != nil && opt.ratelimit == nil {
+		errs = append(errs, fmt.Errorf("rate limit key requires WithRateLimit"))
+	}
+	if opt.memorypressure != nil && opt.memorypressure.Limit == 0 &&
+		(opt.gctuning == nil || opt.gctuning.memlimit == 0) && debug.SetMemoryLimit(-1) == math.MaxInt64 {
+		errs = append(errs, fmt.Errorf("memory pressure requires a memory limit: its Limit, WithGCTuning or GOMEMLIMIT"))
+	}
+	if opt.proxyprotocol != nil && len(opt.proxyprotocol.sources) == 0 {
+		var ipbased []string
+		for _, o := range []struct {
+			name string
+			set  bool
+		}{
+			{"WithTrustedProxies", len(opt.trustedproxies) > 0},
+			{"WithIPFilter", opt.ipfilter != nil},
+			{"WithRateLimit", opt.ratelimit != nil && opt.ratelimitkey == nil},
+			{"WithClientFingerprint", opt.clientfingerprint != nil},
+		} {
+			if o.set {
+				ipbased = append(ipbased, o.name)
+			}
+		}
+		if len(ipbased) > 0 {
+			errs = append(errs, fmt.Errorf("proxy protocol without WithProxyProtocolSources lets clients spoof the address used by %s", strings.Join(ipbased, ", ")))
+		}
+	}
+	if opt.topologyheaders && opt.topology == nil {
+		errs = append(errs, fmt.Errorf("topology headers require WithTopology"))
+	}
+	return errs
+}